@@ -0,0 +1,83 @@
+package madns
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// Builder configures a Resolver step by step, as an alternative to passing NewResolver a long
+// list of options. Configuration errors are collected as they're made and reported together by
+// Build, each saying which step it comes from.
+type Builder struct {
+	opts    []Option
+	domains map[string]struct{}
+	errs    []error
+}
+
+// NewBuilder returns a Builder for a Resolver with the default configuration.
+func NewBuilder() *Builder {
+	return &Builder{domains: make(map[string]struct{})}
+}
+
+// Default sets the resolver used for domains that don't have a custom one.
+func (b *Builder) Default(rslv BasicResolver) *Builder {
+	if rslv == nil {
+		b.errs = append(b.errs, errors.New("default resolver is nil"))
+		return b
+	}
+	return b.With(WithDefaultResolver(rslv))
+}
+
+// AddDomain routes the lookups of domain and its subdomains to rslv. Each domain may only be
+// added once.
+func (b *Builder) AddDomain(domain string, rslv BasicResolver) *Builder {
+	if err := checkDomain(domain); err != nil {
+		b.errs = append(b.errs, err)
+		return b
+	}
+	fqdn := dns.Fqdn(domain)
+	if rslv == nil {
+		b.errs = append(b.errs, fmt.Errorf("resolver for domain %q is nil", domain))
+		return b
+	}
+	if _, ok := b.domains[fqdn]; ok {
+		b.errs = append(b.errs, fmt.Errorf("domain %q added more than once", domain))
+		return b
+	}
+	b.domains[fqdn] = struct{}{}
+	return b.With(WithDomainResolver(domain, rslv))
+}
+
+// IPv4 sets the resolver used for IPv4 lookups, as WithIPv4Resolver does.
+func (b *Builder) IPv4(rslv BasicResolver) *Builder {
+	if rslv == nil {
+		b.errs = append(b.errs, errors.New("IPv4 resolver is nil"))
+		return b
+	}
+	return b.With(WithIPv4Resolver(rslv))
+}
+
+// IPv6 sets the resolver used for IPv6 lookups, as WithIPv6Resolver does.
+func (b *Builder) IPv6(rslv BasicResolver) *Builder {
+	if rslv == nil {
+		b.errs = append(b.errs, errors.New("IPv6 resolver is nil"))
+		return b
+	}
+	return b.With(WithIPv6Resolver(rslv))
+}
+
+// With adds options to the configuration, applied in order after the ones added before.
+func (b *Builder) With(opts ...Option) *Builder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// Build creates the configured Resolver, or returns all the configuration errors found.
+func (b *Builder) Build() (*Resolver, error) {
+	if len(b.errs) > 0 {
+		return nil, errors.Join(b.errs...)
+	}
+	return NewResolver(b.opts...)
+}
@@ -0,0 +1,69 @@
+package madns
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestBuilder(t *testing.T) {
+	custom := &MockResolver{TXT: map[string][]string{"_dnsaddr.custom.test": {txtb}}}
+	resolver, err := NewBuilder().
+		Default(makeResolver().def).
+		AddDomain("custom.test", custom).
+		With(WithStripPeerIDs(), WithMaxConcurrency(2)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		maddr    string
+		expected ma.Multiaddr
+	}{
+		{"/dnsaddr/example.com", ip4ma},
+		{"/dnsaddr/custom.test", ip6ma},
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast(tc.maddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) == 0 || !addrs[0].Equal(tc.expected) {
+			t.Fatalf("%s: expected %s first, got %+v", tc.maddr, tc.expected, addrs)
+		}
+	}
+	if !resolver.stripPeerIDs || resolver.maxConcurrency != 2 {
+		t.Fatal("expected the options to be applied")
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	mock := &MockResolver{}
+	_, err := NewBuilder().
+		Default(nil).
+		AddDomain("bad..domain", mock).
+		AddDomain("eth", mock).
+		AddDomain("eth.", mock).
+		IPv6(nil).
+		Build()
+	if err == nil {
+		t.Fatal("expected the configuration to be rejected")
+	}
+	for _, msg := range []string{
+		"default resolver is nil",
+		`invalid domain "bad..domain"`,
+		`domain "eth." added more than once`,
+		"IPv6 resolver is nil",
+	} {
+		if !strings.Contains(err.Error(), msg) {
+			t.Fatalf("expected the error to mention %q, got %v", msg, err)
+		}
+	}
+
+	if _, err := NewBuilder().With(WithMaxConcurrency(0)).Build(); err == nil {
+		t.Fatal("expected invalid options to be rejected")
+	}
+}
@@ -0,0 +1,66 @@
+package madns
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// CompareResolvers resolves maddr with both a and b and reports how the results differ: the
+// addresses only a returned, the ones only b returned, and the ones both returned. It helps
+// confirm that a new backend returns the same results as the current one before switching over.
+//
+// onlyA and both keep the order a returned them in, onlyB the order b returned them in. If either
+// resolver fails, the error says which one.
+func CompareResolvers(ctx context.Context, a, b *Resolver, maddr ma.Multiaddr) (onlyA, onlyB, both []ma.Multiaddr, err error) {
+	var (
+		addrsA, addrsB []ma.Multiaddr
+		errA, errB     error
+		wg             sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		addrsA, errA = a.Resolve(ctx, maddr)
+	}()
+	go func() {
+		defer wg.Done()
+		addrsB, errB = b.Resolve(ctx, maddr)
+	}()
+	wg.Wait()
+	if errA != nil {
+		return nil, nil, nil, fmt.Errorf("first resolver: %w", errA)
+	}
+	if errB != nil {
+		return nil, nil, nil, fmt.Errorf("second resolver: %w", errB)
+	}
+
+	inB := make(map[string]struct{}, len(addrsB))
+	for _, addr := range addrsB {
+		inB[string(addr.Bytes())] = struct{}{}
+	}
+	inA := make(map[string]struct{}, len(addrsA))
+	for _, addr := range addrsA {
+		key := string(addr.Bytes())
+		if _, ok := inA[key]; ok {
+			continue
+		}
+		inA[key] = struct{}{}
+		if _, ok := inB[key]; ok {
+			both = append(both, addr)
+		} else {
+			onlyA = append(onlyA, addr)
+		}
+	}
+	for _, addr := range addrsB {
+		key := string(addr.Bytes())
+		if _, ok := inA[key]; ok {
+			continue
+		}
+		inA[key] = struct{}{}
+		onlyB = append(onlyB, addr)
+	}
+	return onlyA, onlyB, both, nil
+}
@@ -0,0 +1,63 @@
+package madns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestCompareResolvers(t *testing.T) {
+	ctx := context.Background()
+	newResolver := func(backend BasicResolver) *Resolver {
+		t.Helper()
+		resolver, err := NewResolver(WithDefaultResolver(backend))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resolver
+	}
+	a := newResolver(&MockResolver{
+		IP: map[string][]net.IPAddr{"example.com": {ip4a, ip6a, ip4b}},
+	})
+	b := newResolver(&MockResolver{
+		IP: map[string][]net.IPAddr{"example.com": {ip6b, ip4b, ip4a}},
+	})
+
+	onlyA, onlyB, both, err := CompareResolvers(ctx, a, b, ma.StringCast("/dns/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name     string
+		got      []ma.Multiaddr
+		expected []ma.Multiaddr
+	}{
+		{"onlyA", onlyA, []ma.Multiaddr{ip6ma}},
+		{"onlyB", onlyB, []ma.Multiaddr{ip6mb}},
+		{"both", both, []ma.Multiaddr{ip4ma, ip4mb}},
+	} {
+		if len(tc.got) != len(tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.expected, tc.got)
+		}
+		for i, e := range tc.expected {
+			if !tc.got[i].Equal(e) {
+				t.Fatalf("%s: expected %s at %d, got %s", tc.name, e, i, tc.got[i])
+			}
+		}
+	}
+
+	onlyA, onlyB, both, err = CompareResolvers(ctx, a, a, ma.StringCast("/dns/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onlyA) != 0 || len(onlyB) != 0 || len(both) != 3 {
+		t.Fatalf("expected identical results, got %v, %v and %v", onlyA, onlyB, both)
+	}
+
+	failing := newResolver(&failingResolver{})
+	if _, _, _, err := CompareResolvers(ctx, a, failing, ma.StringCast("/dns/example.com")); err == nil {
+		t.Fatal("expected an error when one of the resolvers fails")
+	}
+}
@@ -0,0 +1,63 @@
+package madns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+)
+
+// WellKnownNAT64Prefix is the well-known prefix used to synthesize IPv6 addresses for IPv4-only
+// hosts behind NAT64, as defined in RFC 6052.
+var WellKnownNAT64Prefix = mustParseCIDRs("64:ff9b::/96")[0]
+
+// WithDNS64 is an option for IPv6-only hosts behind NAT64. When a name has IPv4 addresses but no
+// IPv6 address, its /dns, /dns4 and /dns6 components resolve to /ip6 addresses synthesized by
+// embedding the IPv4 addresses into prefix, as a DNS64 server would. Names with native IPv6
+// addresses are resolved as usual. Only /96 prefixes, like WellKnownNAT64Prefix, are supported.
+//
+// As RFC 6052 requires, non-global IPv4 addresses such as loopback, link-local and the ranges in
+// PrivateRanges are never embedded. They are resolved as /ip4 addresses, where the filters and
+// rebinding protection apply to them as usual.
+func WithDNS64(prefix *net.IPNet) Option {
+	return func(r *Resolver) error {
+		if prefix == nil {
+			return errors.New("nil NAT64 prefix")
+		}
+		ones, bits := prefix.Mask.Size()
+		if bits != 8*net.IPv6len || ones != 96 {
+			return fmt.Errorf("unsupported NAT64 prefix %s, must be an IPv6 /96", prefix)
+		}
+		r.dns64 = prefix
+		return nil
+	}
+}
+
+// synthesizeDNS64 replaces global IPv4 records with IPv6 ones in the NAT64 prefix if there are
+// no IPv6 records, keeping the other IPv4 records as they are. It reports whether it synthesized
+// any record.
+func (r *Resolver) synthesizeDNS64(records []net.IPAddr) ([]net.IPAddr, bool) {
+	if slices.ContainsFunc(records, func(a net.IPAddr) bool { return a.IP.To4() == nil }) {
+		return records, false
+	}
+	synthesized := make([]net.IPAddr, 0, len(records))
+	ok := false
+	for _, a := range records {
+		if !isGlobalIPv4(a.IP) {
+			synthesized = append(synthesized, a)
+			continue
+		}
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, r.dns64.IP.To16()[:12])
+		copy(ip[12:], a.IP.To4())
+		synthesized = append(synthesized, net.IPAddr{IP: ip})
+		ok = true
+	}
+	return synthesized, ok
+}
+
+// isGlobalIPv4 reports whether ip is a globally reachable IPv4 address, which RFC 6052 allows
+// embedding into a NAT64 prefix.
+func isGlobalIPv4(ip net.IP) bool {
+	return ip.To4() != nil && ip.IsGlobalUnicast() && !inRanges(ip, PrivateRanges)
+}
@@ -0,0 +1,132 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestDNS64(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"v4only.com":    {ip4a, ip4b},
+			"dualstack.com": {ip4a, ip6a},
+		},
+	}
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithDNS64(WellKnownNAT64Prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		maddr    string
+		expected []string
+	}{
+		{"/dns4/v4only.com/tcp/1", []string{"/ip6/64:ff9b::c000:201/tcp/1", "/ip6/64:ff9b::c000:202/tcp/1"}},
+		{"/dns6/v4only.com", []string{"/ip6/64:ff9b::c000:201", "/ip6/64:ff9b::c000:202"}},
+		{"/dns/v4only.com", []string{"/ip6/64:ff9b::c000:201", "/ip6/64:ff9b::c000:202"}},
+		// native AAAA records take precedence.
+		{"/dns/dualstack.com", []string{"/ip4/192.0.2.1", "/ip6/2001:db8::a3"}},
+		{"/dns4/dualstack.com", []string{"/ip4/192.0.2.1"}},
+		{"/dns6/dualstack.com", []string{"/ip6/2001:db8::a3"}},
+		{"/dns/missing.com", nil},
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast(tc.maddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("%s: expected %v, got %+v", tc.maddr, tc.expected, addrs)
+		}
+		for i, e := range tc.expected {
+			if addrs[i].String() != e {
+				t.Fatalf("%s: expected %s at %d, got %s", tc.maddr, e, i, addrs[i])
+			}
+		}
+	}
+
+	_, prefix, _ := net.ParseCIDR("64:ff9b:1::/48")
+	if _, err := NewResolver(WithDNS64(prefix)); err == nil {
+		t.Fatal("expected a /48 prefix to be rejected")
+	}
+	_, prefix, _ = net.ParseCIDR("192.0.2.0/24")
+	if _, err := NewResolver(WithDNS64(prefix)); err == nil {
+		t.Fatal("expected an IPv4 prefix to be rejected")
+	}
+}
+
+func TestDNS64NonGlobal(t *testing.T) {
+	loopback := net.IPAddr{IP: net.ParseIP("127.0.0.1")}
+	private := net.IPAddr{IP: net.ParseIP("10.0.0.1")}
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"mixed.com":   {loopback, ip4a, private},
+			"private.com": {loopback, private},
+		},
+	}
+	ctx := context.Background()
+
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithDNS64(WellKnownNAT64Prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		maddr    string
+		expected []string
+	}{
+		{"/dns4/mixed.com", []string{"/ip4/127.0.0.1", "/ip6/64:ff9b::c000:201", "/ip4/10.0.0.1"}},
+		{"/dns6/mixed.com", []string{"/ip6/64:ff9b::c000:201"}},
+		{"/dns4/private.com", []string{"/ip4/127.0.0.1", "/ip4/10.0.0.1"}},
+		{"/dns6/private.com", nil},
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast(tc.maddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("%s: expected %v, got %+v", tc.maddr, tc.expected, addrs)
+		}
+		for i, e := range tc.expected {
+			if addrs[i].String() != e {
+				t.Fatalf("%s: expected %s at %d, got %s", tc.maddr, e, i, addrs[i])
+			}
+		}
+	}
+
+	// The filters still see the non-global addresses.
+	resolver, err = NewResolver(
+		WithDefaultResolver(mock),
+		WithDNS64(WellKnownNAT64Prefix),
+		WithDropPrivateRanges(),
+		WithRebindingProtection(false),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := resolver.Resolve(ctx, ma.StringCast("/dns4/mixed.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != "/ip6/64:ff9b::c000:201" {
+		t.Fatalf("expected only the synthesized global address, got %+v", addrs)
+	}
+	resolver, err = NewResolver(
+		WithDefaultResolver(mock),
+		WithDNS64(WellKnownNAT64Prefix),
+		WithRebindingProtection(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.Resolve(ctx, ma.StringCast("/dns4/mixed.com")); !errors.Is(err, ErrRebinding) {
+		t.Fatalf("expected ErrRebinding, got %v", err)
+	}
+
+	if _, err := NewResolver(WithDNS64(nil)); err == nil {
+		t.Fatal("expected a nil prefix to be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const dnslinkTXTPrefix = "dnslink="
+
+// maxDNSLinkDepth bounds the number of /ipns/<domain> redirects followed by LookupDNSLink.
+const maxDNSLinkDepth = 32
+
+// ErrNoDNSLink is returned by LookupDNSLink when a domain has no dnslink record.
+var ErrNoDNSLink = errors.New("no dnslink record found")
+
+// LookupDNSLink looks up the dnslink TXT record on _dnslink.<host> and returns the path it
+// points to, such as /ipfs/<cid>. Links to /ipns/<domain> are followed, carrying over any
+// trailing path, up to a bounded number of redirects; links to /ipns/<key> are returned as is.
+func (r *Resolver) LookupDNSLink(ctx context.Context, host string) (string, error) {
+	var suffix string
+	for depth := 0; depth < maxDNSLinkDepth; depth++ {
+		records, err := r.LookupTXT(ctx, "_dnslink."+host)
+		if err != nil {
+			return "", err
+		}
+
+		var link string
+		for _, rec := range records {
+			if strings.HasPrefix(rec, dnslinkTXTPrefix) {
+				link = rec[len(dnslinkTXTPrefix):]
+				break
+			}
+		}
+		if link == "" {
+			return "", fmt.Errorf("%w for %s", ErrNoDNSLink, host)
+		}
+
+		name, ok := strings.CutPrefix(link, "/ipns/")
+		if !ok {
+			return link + suffix, nil
+		}
+		next, rest, hasRest := strings.Cut(name, "/")
+		if !strings.Contains(next, ".") {
+			// not a domain name, but an IPNS key.
+			return link + suffix, nil
+		}
+		if hasRest {
+			suffix = "/" + rest + suffix
+		}
+		host = next
+	}
+	return "", fmt.Errorf("dnslink for %s redirects more than %d times", host, maxDNSLinkDepth)
+}
@@ -0,0 +1,43 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLookupDNSLink(t *testing.T) {
+	const cid = "/ipfs/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnslink.direct.com":  {"not a dnslink", "dnslink=" + cid},
+			"_dnslink.key.com":     {"dnslink=/ipns/k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8"},
+			"_dnslink.chained.com": {"dnslink=/ipns/middle.com/docs"},
+			"_dnslink.middle.com":  {"dnslink=/ipns/direct.com/v1"},
+			"_dnslink.loop.com":    {"dnslink=/ipns/loop.com"},
+		},
+	}
+	resolver := &Resolver{def: mock}
+	ctx := context.Background()
+
+	for host, expected := range map[string]string{
+		"direct.com":  cid,
+		"key.com":     "/ipns/k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8",
+		"chained.com": cid + "/v1/docs",
+	} {
+		link, err := resolver.LookupDNSLink(ctx, host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link != expected {
+			t.Fatalf("%s: expected %s, got %s", host, expected, link)
+		}
+	}
+
+	if _, err := resolver.LookupDNSLink(ctx, "none.com"); !errors.Is(err, ErrNoDNSLink) {
+		t.Fatalf("expected ErrNoDNSLink, got %v", err)
+	}
+	if _, err := resolver.LookupDNSLink(ctx, "loop.com"); err == nil {
+		t.Fatal("expected a redirect loop to fail")
+	}
+}
@@ -0,0 +1,73 @@
+package madns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables read by NewResolverFromEnv.
+const (
+	envDNSServer = "MADNS_DNS_SERVER"
+	envDoHURLs   = "MADNS_DOH_URLS"
+	envCacheTTL  = "MADNS_CACHE_TTL"
+)
+
+// NewResolverFromEnv creates a Resolver configured from the environment, for deployments that
+// would rather not write the wiring themselves. When MADNS_DNS_SERVER is set to "host" or
+// "host:port", the default resolver queries that server, on port 53 unless specified, instead of
+// the ones configured on the system. Unset variables leave the defaults as they are, and opts are
+// applied after the environment.
+//
+// DNS-over-HTTPS and caching aren't supported, so MADNS_DOH_URLS and MADNS_CACHE_TTL are
+// rejected rather than silently ignored.
+func NewResolverFromEnv(opts ...Option) (*Resolver, error) {
+	for _, env := range []string{envDoHURLs, envCacheTTL} {
+		if os.Getenv(env) != "" {
+			return nil, fmt.Errorf("%s is not supported", env)
+		}
+	}
+
+	var envOpts []Option
+	if server := os.Getenv(envDNSServer); server != "" {
+		addr, err := dnsServerAddr(server)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", envDNSServer, err)
+		}
+		envOpts = append(envOpts, WithDefaultResolver(serverResolver(addr)))
+	}
+	return NewResolver(append(envOpts, opts...)...)
+}
+
+// dnsServerAddr turns "host" or "host:port" into a "host:port" address to dial. IPv6 hosts
+// without a port may be given with or without brackets.
+func dnsServerAddr(server string) (string, error) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host, port = server, "53"
+		if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+	}
+	if host == "" {
+		return "", fmt.Errorf("missing host in %q", server)
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", fmt.Errorf("invalid port in %q", server)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// serverResolver returns a net.Resolver that sends all its queries to addr.
+func serverResolver(addr string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+}
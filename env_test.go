@@ -0,0 +1,117 @@
+package madns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func startDNSServer(t *testing.T, handler dns.Handler) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	<-started
+	return pc.LocalAddr().String()
+}
+
+func TestNewResolverFromEnv(t *testing.T) {
+	addr := startDNSServer(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+		switch {
+		case q.Name == "example.com." && q.Qtype == dns.TypeA:
+			m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: ip4a.IP})
+		case q.Name == "_dnsaddr.example.com." && q.Qtype == dns.TypeTXT:
+			m.Answer = append(m.Answer, &dns.TXT{Hdr: hdr, Txt: []string{txtb}})
+		case q.Name != "example.com." && q.Name != "_dnsaddr.example.com.":
+			m.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(m)
+	}))
+	ctx := context.Background()
+
+	t.Setenv("MADNS_DNS_SERVER", addr)
+	resolver, err := NewResolverFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for maddr, expected := range map[string]ma.Multiaddr{
+		"/dns4/example.com":    ip4ma,
+		"/dnsaddr/example.com": ip6ma,
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast(maddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || !addrs[0].Equal(expected) {
+			t.Fatalf("%s: expected [%s], got %+v", maddr, expected, addrs)
+		}
+	}
+
+	// Options apply on top of the environment.
+	mock := &MockResolver{IP: map[string][]net.IPAddr{"example.com": {ip4b}}}
+	resolver, err = NewResolverFromEnv(WithDefaultResolver(mock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolver.def != mock {
+		t.Fatal("expected the options to override the environment")
+	}
+
+	t.Setenv("MADNS_DNS_SERVER", "")
+	resolver, err = NewResolverFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolver.def != net.DefaultResolver {
+		t.Fatal("expected the default resolver without MADNS_DNS_SERVER")
+	}
+}
+
+func TestNewResolverFromEnvInvalid(t *testing.T) {
+	for _, tc := range []struct{ env, value string }{
+		{"MADNS_DNS_SERVER", ":53"},
+		{"MADNS_DNS_SERVER", "[]"},
+		{"MADNS_DNS_SERVER", "127.0.0.1:dns"},
+		{"MADNS_DNS_SERVER", "127.0.0.1:0"},
+		{"MADNS_DOH_URLS", "https://dns.example/dns-query"},
+		{"MADNS_CACHE_TTL", "30s"},
+	} {
+		t.Run(tc.env+"="+tc.value, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+			if _, err := NewResolverFromEnv(); err == nil {
+				t.Fatalf("expected %s=%s to be rejected", tc.env, tc.value)
+			}
+		})
+	}
+}
+
+func TestDNSServerAddr(t *testing.T) {
+	for server, expected := range map[string]string{
+		"127.0.0.1":      "127.0.0.1:53",
+		"127.0.0.1:5353": "127.0.0.1:5353",
+		"::1":            "[::1]:53",
+		"[::1]":          "[::1]:53",
+		"[::1]:5353":     "[::1]:5353",
+		"dns.example":    "dns.example:53",
+	} {
+		addr, err := dnsServerAddr(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if addr != expected {
+			t.Fatalf("%s: expected %s, got %s", server, expected, addr)
+		}
+	}
+}
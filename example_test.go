@@ -0,0 +1,51 @@
+package madns_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+)
+
+// ensResolver stands in for a backend resolving names of an alternative naming system, like
+// ENS. A real one would look up the text records of the name, for example with a contract call,
+// and return the ones holding dnsaddr records under the name the resolver asks for.
+type ensResolver struct {
+	records map[string][]string
+}
+
+func (r *ensResolver) LookupIPAddr(ctx context.Context, name string) ([]net.IPAddr, error) {
+	return nil, &net.DNSError{Err: "no addresses on ENS", Name: name, IsNotFound: true}
+}
+
+func (r *ensResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	// /dnsaddr/vitalik.eth asks for _dnsaddr.vitalik.eth.
+	name = strings.TrimPrefix(name, "_dnsaddr.")
+	records, ok := r.records[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such name", Name: name, IsNotFound: true}
+	}
+	return records, nil
+}
+
+// Names of alternative naming systems can be resolved by routing their suffix to a custom
+// backend.
+func ExampleWithDomainResolver() {
+	ens := &ensResolver{records: map[string][]string{
+		"peer.eth": {"dnsaddr=/ip4/192.0.2.1/tcp/4001"},
+	}}
+	resolver, err := madns.NewResolver(madns.WithDomainResolver("eth", ens))
+	if err != nil {
+		panic(err)
+	}
+
+	addrs, err := resolver.Resolve(context.Background(), ma.StringCast("/dnsaddr/peer.eth"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(addrs)
+	// Output: [/ip4/192.0.2.1/tcp/4001]
+}
@@ -0,0 +1,119 @@
+package madns
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/miekg/dns"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PrivateRanges are the address ranges dropped by WithDropPrivateRanges: RFC1918 and CGNAT
+// private IPv4 space, loopback, link-local, and IPv6 unique local addresses (which include
+// overlay ranges such as Tailscale's fd7a:115c:a1e0::/48).
+var PrivateRanges = mustParseCIDRs(
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"::1/128",
+	"fe80::/10",
+	"fc00::/7",
+)
+
+// WithDropRanges is an option that drops resolved addresses whose leading /ip4 or /ip6
+// component falls within any of the given ranges.
+func WithDropRanges(cidrs ...*net.IPNet) Option {
+	return func(r *Resolver) error {
+		r.dropRanges = append(r.dropRanges, cidrs...)
+		return nil
+	}
+}
+
+// WithDropPrivateRanges is an option that drops resolved addresses within PrivateRanges.
+func WithDropPrivateRanges() Option {
+	return WithDropRanges(PrivateRanges...)
+}
+
+// ErrRebinding is returned when a public domain resolves to a private address while rebinding
+// protection is enabled in strict mode.
+var ErrRebinding = errors.New("possible DNS rebinding")
+
+// WithRebindingProtection is an option that guards against DNS rebinding by dropping addresses
+// within PrivateRanges that public domains resolve to. In strict mode, resolution fails with
+// ErrRebinding instead. Domains that are local by definition, such as localhost and .local
+// names, are exempt.
+func WithRebindingProtection(strict bool) Option {
+	return func(r *Resolver) error {
+		r.rebindingProtection = true
+		r.rebindingStrict = strict
+		return nil
+	}
+}
+
+// localSuffixes are the special-use domains expected to resolve to private addresses.
+var localSuffixes = []string{"localhost.", "local.", "internal.", "home.arpa."}
+
+func isLocalName(domain string) bool {
+	fqdn := strings.ToLower(dns.Fqdn(domain))
+	for _, suffix := range localSuffixes {
+		if fqdn == suffix || strings.HasSuffix(fqdn, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// leadingIP returns the IP of the leading /ip4 or /ip6 component of the multiaddr, or nil if
+// the multiaddr doesn't start with one.
+func leadingIP(maddr ma.Multiaddr) net.IP {
+	first, _ := ma.SplitFirst(maddr)
+	if first == nil {
+		return nil
+	}
+	switch first.Protocol().Code {
+	case ma.P_IP4, ma.P_IP6:
+		return net.IP(first.RawValue())
+	default:
+		return nil
+	}
+}
+
+func inRanges(ip net.IP, ranges []*net.IPNet) bool {
+	for _, n := range ranges {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropInRanges removes the addresses whose leading IP falls within any of the ranges.
+func dropInRanges(addrs []ma.Multiaddr, ranges []*net.IPNet) []ma.Multiaddr {
+	if len(ranges) == 0 {
+		return addrs
+	}
+	kept := addrs[:0]
+	for _, addr := range addrs {
+		if ip := leadingIP(addr); ip != nil && inRanges(ip, ranges) {
+			continue
+		}
+		kept = append(kept, addr)
+	}
+	return kept
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
@@ -0,0 +1,147 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func makeRangesResolver(t *testing.T, opts ...Option) *Resolver {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {
+				{IP: net.ParseIP("10.1.2.3")},
+				{IP: net.ParseIP("100.64.1.1")},
+				{IP: net.ParseIP("127.0.0.1")},
+				{IP: net.ParseIP("169.254.1.1")},
+				ip4a,
+				{IP: net.ParseIP("fd7a:115c:a1e0::1")},
+				{IP: net.ParseIP("fe80::1")},
+				ip6a,
+			},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/ip4/192.168.1.1/tcp/123",
+				"dnsaddr=" + txtmd.String(),
+			},
+		},
+	}
+	resolver, err := NewResolver(append([]Option{WithDefaultResolver(mock)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolver
+}
+
+func TestDropPrivateRanges(t *testing.T) {
+	ctx := context.Background()
+	resolver := makeRangesResolver(t, WithDropPrivateRanges())
+
+	addrs, err := resolver.Resolve(ctx, ma.StringCast("/dns/example.com/tcp/1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ma.Multiaddr{
+		ma.Join(ip4ma, ma.StringCast("/tcp/1")),
+		ma.Join(ip6ma, ma.StringCast("/tcp/1")),
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, addrs)
+	}
+	for i := range expected {
+		if !expected[i].Equal(addrs[i]) {
+			t.Fatalf("%d: expected %s, got %s", i, expected[i], addrs[i])
+		}
+	}
+
+	addrs, err = resolver.Resolve(ctx, ma.StringCast("/dnsaddr/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(txtmd) {
+		t.Fatalf("expected [%s], got %+v", txtmd, addrs)
+	}
+}
+
+func TestDropRanges(t *testing.T) {
+	_, cgnat, _ := net.ParseCIDR("100.64.0.0/10")
+	_, tailscale, _ := net.ParseCIDR("fd7a:115c:a1e0::/48")
+	resolver := makeRangesResolver(t, WithDropRanges(cgnat, tailscale))
+
+	addrs, err := resolver.Resolve(context.Background(), ma.StringCast("/dns/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 6 {
+		t.Fatalf("expected 6 addresses, got %+v", addrs)
+	}
+	for _, addr := range addrs {
+		ip := leadingIP(addr)
+		if cgnat.Contains(ip) || tailscale.Contains(ip) {
+			t.Fatalf("expected %s to be dropped", addr)
+		}
+	}
+}
+
+func TestRebindingProtection(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com":        {ip4a, {IP: net.ParseIP("127.0.0.1")}, {IP: net.ParseIP("fe80::1")}},
+			"public.com":         {ip4a, ip6a},
+			"printer.local":      {{IP: net.ParseIP("192.168.1.10")}},
+			"dev.localhost":      {{IP: net.ParseIP("127.0.0.1")}},
+			"attacker.com":       {{IP: net.ParseIP("10.0.0.1")}},
+			"router.home.arpa":   {{IP: net.ParseIP("192.168.0.1")}},
+			"service.internal":   {{IP: net.ParseIP("10.1.1.1")}},
+			"localhost.evil.com": {{IP: net.ParseIP("127.0.0.1")}},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {"dnsaddr=/ip4/127.0.0.1/tcp/1", txtd},
+		},
+	}
+	ctx := context.Background()
+
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithRebindingProtection(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		maddr string
+		n     int
+	}{
+		{"/dns/example.com", 1},
+		{"/dnsaddr/example.com", 1},
+		{"/dns4/attacker.com", 0},
+		{"/dns4/localhost.evil.com", 0},
+		{"/dns4/printer.local", 1},
+		{"/dns4/dev.localhost", 1},
+		{"/dns4/router.home.arpa", 1},
+		{"/dns4/service.internal", 1},
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast(tc.maddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != tc.n {
+			t.Fatalf("%s: expected %d addresses, got %+v", tc.maddr, tc.n, addrs)
+		}
+	}
+
+	strict, err := NewResolver(WithDefaultResolver(mock), WithRebindingProtection(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strict.Resolve(ctx, ma.StringCast("/dns/example.com")); !errors.Is(err, ErrRebinding) {
+		t.Fatalf("expected ErrRebinding, got %v", err)
+	}
+	if addrs, err := strict.Resolve(ctx, ma.StringCast("/dns/public.com")); err != nil || len(addrs) != 2 {
+		t.Fatalf("expected 2 addresses, got %+v (%v)", addrs, err)
+	}
+	if addrs, err := strict.Resolve(ctx, ma.StringCast("/dns4/printer.local")); err != nil || len(addrs) != 1 {
+		t.Fatalf("expected 1 address, got %+v (%v)", addrs, err)
+	}
+}
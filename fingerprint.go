@@ -0,0 +1,34 @@
+package madns
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"slices"
+	"strings"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ResultFingerprint returns a stable hash of a set of addresses, for detecting when the addresses
+// a name resolves to change. Order and duplicates don't matter: addresses that are the same set
+// have the same fingerprint. Nil addresses are ignored.
+func ResultFingerprint(addrs []ma.Multiaddr) string {
+	keys := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr != nil {
+			keys = append(keys, string(addr.Bytes()))
+		}
+	}
+	slices.SortFunc(keys, strings.Compare)
+	keys = slices.Compact(keys)
+
+	// Length-prefix the addresses so that the boundaries between them are part of the hash.
+	h := sha256.New()
+	var buf [binary.MaxVarintLen64]byte
+	for _, key := range keys {
+		h.Write(buf[:binary.PutUvarint(buf[:], uint64(len(key)))])
+		h.Write([]byte(key))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
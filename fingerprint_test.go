@@ -0,0 +1,39 @@
+package madns
+
+import (
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestResultFingerprint(t *testing.T) {
+	addrs := []ma.Multiaddr{ip4ma, ip6ma, txtmc, ip4mb}
+	fp := ResultFingerprint(addrs)
+
+	for _, same := range [][]ma.Multiaddr{
+		{ip4mb, txtmc, ip6ma, ip4ma},
+		{txtmc, ip4ma, ip4mb, ip6ma},
+		{ip4ma, ip6ma, ip4ma, txtmc, ip4mb, ip6ma},
+		{ip4ma, nil, ip6ma, txtmc, ip4mb},
+		{ma.StringCast(ip4ma.String()), ip6ma, txtmc, ip4mb},
+	} {
+		if got := ResultFingerprint(same); got != fp {
+			t.Fatalf("expected %v to have the fingerprint of %v", same, addrs)
+		}
+	}
+
+	for _, different := range [][]ma.Multiaddr{
+		{ip4ma, ip6ma, txtmc},
+		{ip4ma, ip6ma, txtmc, ip4mb, ip6mb},
+		{ip4ma, ip6ma, txtmd, ip4mb},
+		nil,
+	} {
+		if got := ResultFingerprint(different); got == fp {
+			t.Fatalf("expected %v to have a different fingerprint from %v", different, addrs)
+		}
+	}
+
+	if ResultFingerprint(nil) != ResultFingerprint([]ma.Multiaddr{}) {
+		t.Fatal("expected no addresses to have a single fingerprint")
+	}
+}
@@ -5,18 +5,34 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
 )
 
 func main() {
+	// MADNS_DNS_SERVER picks the DNS server to query.
+	resolver, err := madns.NewResolverFromEnv()
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) == 3 && os.Args[1] == "doctor" {
+		if !doctor(resolver, os.Args[2]) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if len(os.Args) != 2 {
 		fmt.Print("usage: madns /dnsaddr/example.com\n" +
 			"       madns /dnsaddr/example.com/ipfs/Qmfoobar\n" +
 			"       madns /dns6/example.com\n" +
 			"       madns /dns6/example.com/tcp/443/wss\n" +
-			"       madns /dns4/example.com\n")
+			"       madns /dns4/example.com\n" +
+			"       madns doctor example.com\n")
 		os.Exit(1)
 	}
 
@@ -32,7 +48,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	rmaddrs, err := madns.Resolve(context.Background(), maddr)
+	rmaddrs, err := resolver.Resolve(context.Background(), maddr)
 	if err != nil {
 		fmt.Printf("error: %s (result=%+v)\n", err, rmaddrs)
 		os.Exit(1)
@@ -42,3 +58,79 @@ func main() {
 		fmt.Println(r.String())
 	}
 }
+
+// doctor runs the A, AAAA and dnsaddr TXT lookups for name through resolver, reporting what each
+// one returned and how long it took, then what /dnsaddr/name resolves to. It reports whether
+// anything usable was found.
+func doctor(resolver *madns.Resolver, name string) bool {
+	ctx := context.Background()
+	found := false
+
+	// Each family is resolved on its own, through /dns4 and /dns6, so that both get their own
+	// timing.
+	for _, family := range []struct {
+		rtype, proto string
+	}{{"A", "dns4"}, {"AAAA", "dns6"}} {
+		c, err := ma.NewComponent(family.proto, name)
+		if err != nil {
+			fmt.Printf("%-4s %s: error: %s\n", family.rtype, name, err)
+			continue
+		}
+		start := time.Now()
+		addrs, err := resolver.Resolve(ctx, c)
+		took := time.Since(start)
+		if err != nil {
+			fmt.Printf("%-4s %s: error: %s (%s)\n", family.rtype, name, err, took)
+			continue
+		}
+		fmt.Printf("%-4s %s: %d records (%s)\n", family.rtype, name, len(addrs), took)
+		for _, addr := range addrs {
+			ip, err := addr.ValueForProtocol(ma.P_IP4)
+			if err != nil {
+				ip, _ = addr.ValueForProtocol(ma.P_IP6)
+			}
+			fmt.Printf("     %s\n", ip)
+		}
+		found = found || len(addrs) > 0
+	}
+
+	txtName := "_dnsaddr." + name
+	start := time.Now()
+	records, err := resolver.LookupTXT(ctx, txtName)
+	took := time.Since(start)
+	if err != nil {
+		fmt.Printf("TXT  %s: error: %s (%s)\n", txtName, err, took)
+	} else {
+		fmt.Printf("TXT  %s: %d records (%s)\n", txtName, len(records), took)
+		for _, r := range records {
+			addr, ok := strings.CutPrefix(r, "dnsaddr=")
+			if !ok {
+				fmt.Printf("     ignored, not a dnsaddr record: %q\n", r)
+				continue
+			}
+			if _, err := ma.NewMultiaddr(addr); err != nil {
+				fmt.Printf("     invalid multiaddr %q: %s\n", addr, err)
+				continue
+			}
+			fmt.Printf("     %s\n", addr)
+		}
+	}
+
+	dnsaddr, err := ma.NewComponent("dnsaddr", name)
+	if err != nil {
+		fmt.Printf("/dnsaddr/%s: error: %s\n", name, err)
+		return found
+	}
+	start = time.Now()
+	addrs, err := resolver.Resolve(ctx, dnsaddr)
+	took = time.Since(start)
+	if err != nil {
+		fmt.Printf("%s: error: %s (%s)\n", dnsaddr, err, took)
+		return found
+	}
+	fmt.Printf("%s: resolves to %d addresses (%s)\n", dnsaddr, len(addrs), took)
+	for _, addr := range addrs {
+		fmt.Printf("     %s\n", addr)
+	}
+	return found || len(addrs) > 0
+}
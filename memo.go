@@ -0,0 +1,67 @@
+package madns
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// lookupMemo shares the IP lookups made during a single ResolveAll call, so that a name that
+// appears in several components, as in /dns4/example.com/tcp/1/dns6/example.com/tcp/2, is only
+// looked up once per backend. Concurrent lookups of the same name wait for the first one.
+type lookupMemo struct {
+	mu      sync.Mutex
+	entries map[memoKey]*memoEntry
+}
+
+// memoKey identifies a lookup by backend and canonical name: DNS names are case-insensitive and
+// may be written fully qualified, so example.com, Example.com. and example.com. share an entry.
+// The record type is implied, as only IP lookups, which ask for both A and AAAA records, are
+// memoized.
+type memoKey struct {
+	rslv BasicResolver
+	name string
+}
+
+func canonicalName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+type memoEntry struct {
+	done chan struct{}
+	res  []net.IPAddr
+	err  error
+}
+
+type lookupMemoKey struct{}
+
+func withLookupMemo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lookupMemoKey{}, &lookupMemo{entries: make(map[memoKey]*memoEntry)})
+}
+
+// lookupIPAddr returns the memoized answer of rslv for name, calling lookup if there isn't one.
+// Backends that can't be used as map keys aren't memoized.
+func (m *lookupMemo) lookupIPAddr(rslv BasicResolver, name string, lookup func() ([]net.IPAddr, error)) ([]net.IPAddr, error) {
+	if !reflect.TypeOf(rslv).Comparable() {
+		return lookup()
+	}
+	key := memoKey{rslv, canonicalName(name)}
+
+	m.mu.Lock()
+	e, ok := m.entries[key]
+	if !ok {
+		e = &memoEntry{done: make(chan struct{})}
+		m.entries[key] = e
+	}
+	m.mu.Unlock()
+
+	if ok {
+		<-e.done
+	} else {
+		e.res, e.err = lookup()
+		close(e.done)
+	}
+	return e.res, e.err
+}
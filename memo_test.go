@@ -0,0 +1,97 @@
+package madns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestResolveAllSharesLookups(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip4a, ip4b, ip6a},
+		},
+	}
+	backend := &RecordingResolver{Resolver: mock}
+	resolver, err := NewResolver(WithDefaultResolver(backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dns4/example.com/tcp/1/dns6/example.com/tcp/2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"/ip4/192.0.2.1/tcp/1/ip6/2001:db8::a3/tcp/2",
+		"/ip4/192.0.2.2/tcp/1/ip6/2001:db8::a3/tcp/2",
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %v, got %+v", expected, addrs)
+	}
+	for i, e := range expected {
+		if addrs[i].String() != e {
+			t.Fatalf("expected %s at %d, got %s", e, i, addrs[i])
+		}
+	}
+
+	lookups := backend.Lookups()
+	if len(lookups) != 1 || lookups[0] != (Lookup{LookupKindIPAddr, "example.com"}) {
+		t.Fatalf("expected a single lookup of example.com, got %+v", lookups)
+	}
+	if n := resolver.Stats().IPLookups; n != 1 {
+		t.Fatalf("expected 1 IP lookup in the stats, got %d", n)
+	}
+
+	// The lookups are only shared within a call.
+	if _, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dns4/example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(backend.Lookups()); n != 2 {
+		t.Fatalf("expected a new lookup for a new call, got %d lookups", n)
+	}
+}
+
+func TestResolveAllSharesLookupsPerBackend(t *testing.T) {
+	v4 := &RecordingResolver{Resolver: &MockResolver{IP: map[string][]net.IPAddr{"example.com": {ip4a}}}}
+	v6 := &RecordingResolver{Resolver: &MockResolver{IP: map[string][]net.IPAddr{"example.com": {ip6a}}}}
+	resolver, err := NewResolver(WithIPv4Resolver(v4), WithIPv6Resolver(v6))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dns4/example.com/tcp/1/dns6/example.com/tcp/2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != "/ip4/192.0.2.1/tcp/1/ip6/2001:db8::a3/tcp/2" {
+		t.Fatalf("unexpected addresses %+v", addrs)
+	}
+	if len(v4.Lookups()) != 1 || len(v6.Lookups()) != 1 {
+		t.Fatalf("expected one lookup per backend, got %+v and %+v", v4.Lookups(), v6.Lookups())
+	}
+}
+
+func TestResolveAllSharesLookupsOfEquivalentNames(t *testing.T) {
+	backend := &RecordingResolver{Resolver: &MockResolver{
+		IP: map[string][]net.IPAddr{"example.com": {ip4a}},
+	}}
+	resolver, err := NewResolver(WithDefaultResolver(backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maddr := ma.StringCast("/dns4/example.com/tcp/1/dns4/Example.com./tcp/2/dns4/example.com./tcp/3")
+	addrs, err := resolver.ResolveAll(context.Background(), maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != "/ip4/192.0.2.1/tcp/1/ip4/192.0.2.1/tcp/2/ip4/192.0.2.1/tcp/3" {
+		t.Fatalf("unexpected addresses %+v", addrs)
+	}
+	if lookups := backend.Lookups(); len(lookups) != 1 {
+		t.Fatalf("expected a single lookup, got %+v", lookups)
+	}
+}
@@ -0,0 +1,85 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// MergingResolver is a BasicResolver that queries all of its resolvers concurrently and returns
+// the union of their answers, for deployments that want the coverage of several backends, such as
+// the system resolver and a DNS-over-HTTPS one.
+//
+// Answers are deduplicated and kept in the order of Resolvers, then in the order each resolver
+// returned them. Resolvers that fail are ignored as long as at least one succeeds; if all of them
+// fail, the errors are returned joined together.
+type MergingResolver struct {
+	Resolvers []BasicResolver
+}
+
+var _ BasicResolver = (*MergingResolver)(nil)
+
+func (r *MergingResolver) LookupIPAddr(ctx context.Context, name string) ([]net.IPAddr, error) {
+	return mergeLookups(ctx, r.Resolvers, func(ctx context.Context, rslv BasicResolver) ([]net.IPAddr, error) {
+		return rslv.LookupIPAddr(ctx, name)
+	}, func(addr net.IPAddr) string {
+		return string(addr.IP.To16()) + "%" + addr.Zone
+	})
+}
+
+func (r *MergingResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return mergeLookups(ctx, r.Resolvers, func(ctx context.Context, rslv BasicResolver) ([]string, error) {
+		return rslv.LookupTXT(ctx, name)
+	}, func(txt string) string {
+		return txt
+	})
+}
+
+// mergeLookups runs lookup against every resolver at once and merges the answers, deduplicating
+// them by key.
+func mergeLookups[T any](
+	ctx context.Context,
+	resolvers []BasicResolver,
+	lookup func(context.Context, BasicResolver) ([]T, error),
+	key func(T) string,
+) ([]T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	answers := make([][]T, len(resolvers))
+	errs := make([]error, len(resolvers))
+	var wg sync.WaitGroup
+	for i, rslv := range resolvers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			answers[i], errs[i] = lookup(ctx, rslv)
+		}()
+	}
+	wg.Wait()
+
+	var (
+		merged []T
+		failed int
+		seen   = make(map[string]struct{})
+	)
+	for i, answer := range answers {
+		if errs[i] != nil {
+			failed++
+			continue
+		}
+		for _, a := range answer {
+			k := key(a)
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			merged = append(merged, a)
+		}
+	}
+	if failed > 0 && failed == len(resolvers) {
+		return nil, errors.Join(errs...)
+	}
+	return merged, nil
+}
@@ -0,0 +1,99 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// blockingResolver blocks every lookup until its context is done.
+type blockingResolver struct{}
+
+func (*blockingResolver) LookupIPAddr(ctx context.Context, _ string) ([]net.IPAddr, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (*blockingResolver) LookupTXT(ctx context.Context, _ string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestMergingResolver(t *testing.T) {
+	ctx := context.Background()
+	a := &MockResolver{
+		IP:  map[string][]net.IPAddr{"example.com": {ip4a, ip6a}},
+		TXT: map[string][]string{"_dnsaddr.example.com": {txta, txtb}},
+	}
+	b := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip6a, ip4b},
+			"other.com":   {ip6b},
+		},
+		TXT: map[string][]string{"_dnsaddr.example.com": {txtc, txta}},
+	}
+	merging := &MergingResolver{Resolvers: []BasicResolver{a, &failingResolver{}, b}}
+
+	ips, err := merging.LookupIPAddr(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedIPs := []net.IPAddr{ip4a, ip6a, ip4b}
+	if len(ips) != len(expectedIPs) {
+		t.Fatalf("expected %v, got %v", expectedIPs, ips)
+	}
+	for i, e := range expectedIPs {
+		if !ips[i].IP.Equal(e.IP) {
+			t.Fatalf("expected %s at %d, got %s", e.IP, i, ips[i].IP)
+		}
+	}
+
+	txts, err := merging.LookupTXT(ctx, "_dnsaddr.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTXTs := []string{txta, txtb, txtc}
+	if len(txts) != len(expectedTXTs) {
+		t.Fatalf("expected %v, got %v", expectedTXTs, txts)
+	}
+	for i, e := range expectedTXTs {
+		if txts[i] != e {
+			t.Fatalf("expected %s at %d, got %s", e, i, txts[i])
+		}
+	}
+
+	// Names only one backend knows about are still found.
+	ips, err = merging.LookupIPAddr(ctx, "other.com")
+	if err != nil || len(ips) != 1 || !ips[0].IP.Equal(ip6b.IP) {
+		t.Fatalf("expected [%s], got %v, %v", ip6b.IP, ips, err)
+	}
+
+	failing := &MergingResolver{Resolvers: []BasicResolver{&failingResolver{}, &ZoneResolver{}}}
+	_, err = failing.LookupTXT(ctx, "example.com")
+	var dnsErr *net.DNSError
+	if err == nil || !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("expected the joined errors of all backends, got %v", err)
+	}
+}
+
+func TestMergingResolverCancel(t *testing.T) {
+	merging := &MergingResolver{Resolvers: []BasicResolver{&blockingResolver{}, &blockingResolver{}}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := merging.LookupIPAddr(ctx, "example.com")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the deadline to be exceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lookups weren't canceled")
+	}
+}
@@ -0,0 +1,138 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ErrNotDnsaddrRecord is reported for TXT records on a _dnsaddr name that don't start with
+// "dnsaddr=".
+var ErrNotDnsaddrRecord = errors.New("not a dnsaddr record")
+
+// ErrRecordSuffixMismatch is reported for dnsaddr records that don't end with the part of the
+// multiaddr following the /dnsaddr component.
+var ErrRecordSuffixMismatch = errors.New("dnsaddr record does not match the multiaddr suffix")
+
+// ErrRecordTooLong is reported for dnsaddr records longer than the limit set with
+// WithMaxTXTRecordLen.
+var ErrRecordTooLong = errors.New("dnsaddr record too long")
+
+// ErrRecordRejected is reported for dnsaddr records rejected by the validator set with
+// WithTXTRecordValidator.
+var ErrRecordRejected = errors.New("dnsaddr record rejected by validator")
+
+// ErrRecordTransportFiltered is reported for dnsaddr records dropped by the filter set with
+// WithDnsaddrTransportFilter.
+var ErrRecordTransportFiltered = errors.New("dnsaddr record transport filtered out")
+
+// ErrTXTBudgetExceeded is reported for the dnsaddr records left unprocessed once the budget set
+// with WithMaxTXTBytes runs out.
+var ErrTXTBudgetExceeded = errors.New("TXT record budget exceeded")
+
+// RecordError describes a dnsaddr TXT record that was skipped during resolution.
+type RecordError struct {
+	// Name is the name the record was found on.
+	Name string
+	// Record is the raw TXT record.
+	Record string
+	// Err is why the record was skipped: ErrNotDnsaddrRecord, ErrRecordTooLong,
+	// ErrRecordTransportFiltered, ErrRecordSuffixMismatch, ErrRecordRejected,
+	// ErrTXTBudgetExceeded or the error from parsing the multiaddr.
+	Err error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("skipped TXT record %q on %s: %s", e.Record, e.Name, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Outcome tells apart the ways a resolution can end.
+type Outcome int
+
+const (
+	// OutcomeResolved means the component resolved to at least one address.
+	OutcomeResolved Outcome = iota
+	// OutcomeNoRecords means there were no records for the component.
+	OutcomeNoRecords
+	// OutcomeFiltered means there were records for the component, but all of them were
+	// skipped or filtered out, for example because no dnsaddr record matched the suffix of the
+	// multiaddr or because all addresses were in dropped ranges.
+	OutcomeFiltered
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeResolved:
+		return "resolved"
+	case OutcomeNoRecords:
+		return "no records"
+	case OutcomeFiltered:
+		return "filtered"
+	default:
+		return fmt.Sprintf("Outcome(%d)", int(o))
+	}
+}
+
+// ResolveMeta describes how a resolution went, beyond the addresses it produced.
+type ResolveMeta struct {
+	// Outcome is how the resolution ended. Resolving a multiaddr without a resolvable component
+	// counts as resolved.
+	Outcome Outcome
+	// Records lists the raw dnsaddr TXT records that matched, in the order they were returned
+	// by the backend. The addresses parsed from them may still have been filtered out later.
+	Records []string
+	// RecordErrors lists the dnsaddr TXT records that were skipped, in the order they were
+	// returned by the backend. Records on the apex queried with WithDnsaddrQueryApex are only
+	// listed if they look like dnsaddr records, as most apex records have nothing to do with
+	// dnsaddr.
+	RecordErrors []RecordError
+}
+
+// ResolveWithMeta is like Resolve, but also returns details about the resolution, such as the
+// dnsaddr records that had to be skipped. It's meant for tools that validate dnsaddr zones.
+func (r *Resolver) ResolveWithMeta(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multiaddr, *ResolveMeta, error) {
+	meta := new(ResolveMeta)
+	addrs, err := r.resolveFirst(ctx, maddr, nil, meta)
+	return addrs, meta, r.checkResult(hasResolvable(maddr), len(addrs), err)
+}
+
+// ResolveVerbose is like Resolve, but also returns the raw dnsaddr TXT records that matched,
+// unmodified, for logging and debugging. It's a lighter alternative to ResolveWithMeta.
+func (r *Resolver) ResolveVerbose(ctx context.Context, maddr ma.Multiaddr) (parsed []ma.Multiaddr, raw []string, err error) {
+	parsed, meta, err := r.ResolveWithMeta(ctx, maddr)
+	return parsed, meta.Records, err
+}
+
+func (m *ResolveMeta) setOutcome(o Outcome) {
+	if m != nil {
+		m.Outcome = o
+	}
+}
+
+func (m *ResolveMeta) addRecord(record string) {
+	if m != nil {
+		m.Records = append(m.Records, record)
+	}
+}
+
+func (m *ResolveMeta) addRecordError(name, record string, err error) {
+	if m == nil {
+		return
+	}
+	m.RecordErrors = append(m.RecordErrors, RecordError{Name: name, Record: record, Err: err})
+}
+
+// recordName returns the name that the i-th of the TXT records looked up for a /dnsaddr value was
+// found on, given that the first n came from the _dnsaddr name.
+func recordName(value string, i, n int) string {
+	if i < n {
+		return "_dnsaddr." + value
+	}
+	return value
+}
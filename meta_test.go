@@ -0,0 +1,193 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestResolveWithMetaRecordErrors(t *testing.T) {
+	const p2p = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	good := "dnsaddr=/ip4/192.0.2.1/tcp/4001" + p2p
+	bad := []string{
+		"v=spf1 -all",
+		"dnsaddr=",
+		"dnsaddr=/foobar",
+		"dnsaddr=/ip4/999.0.0.1/tcp/4001",
+		"dnsaddr=/ip4/192.0.2.1/tcp",
+		"dnsaddr=/ip4/192.0.2.1/tcp/4001/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN",
+		"dnsaddr=/tcp/4001",
+	}
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": append([]string{good}, bad...),
+			"example.com":          {"google-site-verification=foo", "dnsaddr=/garbage"},
+		},
+	}
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithDnsaddrQueryApex(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, meta, err := resolver.ResolveWithMeta(context.Background(), ma.StringCast("/dnsaddr/example.com"+p2p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != good[len(dnsaddrTXTPrefix):] {
+		t.Fatalf("expected only the good record, got %+v", addrs)
+	}
+
+	expected := []struct {
+		name, record string
+		err          error
+	}{
+		{"_dnsaddr.example.com", bad[0], ErrNotDnsaddrRecord},
+		{"_dnsaddr.example.com", bad[1], nil},
+		{"_dnsaddr.example.com", bad[2], nil},
+		{"_dnsaddr.example.com", bad[3], nil},
+		{"_dnsaddr.example.com", bad[4], nil},
+		{"_dnsaddr.example.com", bad[5], ErrRecordSuffixMismatch},
+		{"_dnsaddr.example.com", bad[6], ErrRecordSuffixMismatch},
+		{"example.com", "dnsaddr=/garbage", nil},
+	}
+	if len(meta.RecordErrors) != len(expected) {
+		t.Fatalf("expected %d record errors, got %+v", len(expected), meta.RecordErrors)
+	}
+	for i, e := range expected {
+		re := meta.RecordErrors[i]
+		if re.Name != e.name || re.Record != e.record {
+			t.Fatalf("%d: expected %q on %s, got %q on %s", i, e.record, e.name, re.Record, re.Name)
+		}
+		if re.Err == nil {
+			t.Fatalf("%d: expected an error for %q", i, re.Record)
+		}
+		// parse failures carry the multiaddr error rather than a sentinel.
+		if e.err != nil && !errors.Is(&re, e.err) {
+			t.Fatalf("%d: expected %v, got %v", i, e.err, re.Err)
+		}
+		if e.err == nil && (errors.Is(&re, ErrNotDnsaddrRecord) || errors.Is(&re, ErrRecordSuffixMismatch)) {
+			t.Fatalf("%d: expected a parse error, got %v", i, re.Err)
+		}
+	}
+
+	// Resolving without asking for the details works the same.
+	addrs, err = resolver.Resolve(context.Background(), ma.StringCast("/dnsaddr/example.com"+p2p))
+	if err != nil || len(addrs) != 1 {
+		t.Fatalf("expected one address, got %+v, %v", addrs, err)
+	}
+}
+
+func TestResolveWithMetaTransportFiltered(t *testing.T) {
+	quic := "dnsaddr=/ip4/192.0.2.1/udp/4001/quic-v1"
+	tcp := "dnsaddr=/ip4/192.0.2.1/tcp/4001"
+	mock := &MockResolver{TXT: map[string][]string{"_dnsaddr.example.com": {quic, tcp}}}
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithDnsaddrTransportFilter([]string{"tcp"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, meta, err := resolver.ResolveWithMeta(context.Background(), ma.StringCast("/dnsaddr/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != tcp[len(dnsaddrTXTPrefix):] {
+		t.Fatalf("expected only the tcp record, got %+v", addrs)
+	}
+	if len(meta.RecordErrors) != 1 || meta.RecordErrors[0].Record != quic ||
+		!errors.Is(&meta.RecordErrors[0], ErrRecordTransportFiltered) {
+		t.Fatalf("expected the quic record to be reported as filtered, got %+v", meta.RecordErrors)
+	}
+}
+
+func TestResolveWithMetaOutcome(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip4a, ip6a},
+			"v6only.com":  {ip6a},
+			"private.com": {{IP: net.ParseIP("10.0.0.1")}},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta, txtb},
+			"_dnsaddr.junk.com":    {"not a dnsaddr", "dnsaddr=/foobar"},
+			"_dnsaddr.other.com":   {txtc},
+		},
+	}
+	ctx := context.Background()
+
+	cases := []struct {
+		maddr   string
+		outcome Outcome
+	}{
+		{"/dnsaddr/example.com", OutcomeResolved},
+		{"/dns4/example.com", OutcomeResolved},
+		{"/ip4/192.0.2.1", OutcomeResolved},
+		{"/dnsaddr/missing.com", OutcomeNoRecords},
+		{"/dns/missing.com", OutcomeNoRecords},
+		{"/dns4/v6only.com", OutcomeNoRecords},
+		{"/dnsaddr/junk.com", OutcomeFiltered},
+		{"/dnsaddr/other.com/tcp/999", OutcomeFiltered},
+		{"/dns4/private.com", OutcomeFiltered},
+	}
+
+	for _, errorOnEmpty := range []bool{false, true} {
+		resolver, err := NewResolver(
+			WithDefaultResolver(mock),
+			WithDropPrivateRanges(),
+			WithErrorOnEmpty(errorOnEmpty),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tc := range cases {
+			addrs, meta, err := resolver.ResolveWithMeta(ctx, ma.StringCast(tc.maddr))
+			if meta.Outcome != tc.outcome {
+				t.Fatalf("%s: expected outcome %s, got %s", tc.maddr, tc.outcome, meta.Outcome)
+			}
+			if tc.outcome == OutcomeResolved {
+				if err != nil || len(addrs) == 0 {
+					t.Fatalf("%s: expected addresses, got %+v, %v", tc.maddr, addrs, err)
+				}
+				continue
+			}
+			if len(addrs) != 0 {
+				t.Fatalf("%s: expected no addresses, got %+v", tc.maddr, addrs)
+			}
+			if errorOnEmpty && !errors.Is(err, ErrNoResolvableAddrs) {
+				t.Fatalf("%s: expected ErrNoResolvableAddrs, got %v", tc.maddr, err)
+			}
+			if !errorOnEmpty && err != nil {
+				t.Fatalf("%s: expected no error, got %v", tc.maddr, err)
+			}
+		}
+	}
+}
+
+func TestResolveVerbose(t *testing.T) {
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {"dnsaddr=/ip4/192.0.2.1/tcp/0123", "not a dnsaddr", txtd, "dnsaddr=/dns4/Node.example.com/tcp/123"},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	parsed, raw, err := resolver.ResolveVerbose(context.Background(), ma.StringCast("/dnsaddr/example.com/tcp/123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRaw := []string{"dnsaddr=/ip4/192.0.2.1/tcp/0123", txtd, "dnsaddr=/dns4/Node.example.com/tcp/123"}
+	if len(raw) != len(expectedRaw) {
+		t.Fatalf("expected %v, got %v", expectedRaw, raw)
+	}
+	for i, e := range expectedRaw {
+		if raw[i] != e {
+			t.Fatalf("expected %s at %d, got %s", e, i, raw[i])
+		}
+	}
+	// the parsed addresses are normalized and deduplicated, the raw records aren't.
+	if len(parsed) != 2 || !parsed[0].Equal(txtmd) || parsed[1].String() != "/dns4/node.example.com/tcp/123" {
+		t.Fatalf("unexpected addresses %+v", parsed)
+	}
+}
@@ -2,9 +2,26 @@ package madns
 
 import (
 	"context"
+	"fmt"
+	"math/rand/v2"
 	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
 )
 
+// MockResolver is a BasicResolver answering from static maps of names to records. Besides exact
+// names, keys may be wildcards: "*.example.com" answers for any subdomain of example.com, and
+// "*" for any name. Exact names take precedence over wildcards, and more specific wildcards over
+// less specific ones. Like DNS, names are matched case-insensitively and with or without a
+// trailing dot, so "Example.com." is answered from the records of "example.com".
+//
+// Names written in lowercase without a trailing dot are found directly; others are found by
+// going through the map on every lookup, so changes to the maps take effect immediately. If
+// several such names match, as "Example.com" and "example.com." do, the lookup fails.
 type MockResolver struct {
 	IP  map[string][]net.IPAddr
 	TXT map[string][]string
@@ -13,7 +30,10 @@ type MockResolver struct {
 var _ BasicResolver = (*MockResolver)(nil)
 
 func (r *MockResolver) LookupIPAddr(ctx context.Context, name string) ([]net.IPAddr, error) {
-	results, ok := r.IP[name]
+	results, ok, err := mockLookup(r.IP, name)
+	if err != nil {
+		return nil, err
+	}
 	if ok {
 		return results, nil
 	} else {
@@ -22,10 +42,154 @@ func (r *MockResolver) LookupIPAddr(ctx context.Context, name string) ([]net.IPA
 }
 
 func (r *MockResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
-	results, ok := r.TXT[name]
+	results, ok, err := mockLookup(r.TXT, name)
+	if err != nil {
+		return nil, err
+	}
 	if ok {
 		return results, nil
 	} else {
 		return []string{}, nil
 	}
 }
+
+func mockLookup[T any](records map[string]T, name string) (T, bool, error) {
+	name = canonicalName(name)
+	if results, ok, err := mockGet(records, name); ok || err != nil {
+		return results, ok, err
+	}
+	for rest := name; ; {
+		i := strings.IndexByte(rest, '.')
+		if i < 0 {
+			break
+		}
+		rest = rest[i+1:]
+		if results, ok, err := mockGet(records, "*."+rest); ok || err != nil {
+			return results, ok, err
+		}
+	}
+	return mockGet(records, "*")
+}
+
+// mockGet returns the records of the name that canonicalizes to key.
+func mockGet[T any](records map[string]T, key string) (T, bool, error) {
+	if results, ok := records[key]; ok {
+		return results, true, nil
+	}
+	var matches []string
+	for name := range records {
+		if canonicalName(name) == key {
+			matches = append(matches, name)
+		}
+	}
+	var zero T
+	switch len(matches) {
+	case 0:
+		return zero, false, nil
+	case 1:
+		return records[matches[0]], true, nil
+	default:
+		slices.Sort(matches)
+		return zero, false, fmt.Errorf("mock records for %q are all for %s", matches, key)
+	}
+}
+
+// MockHandler is a ResolveHandler backed by a static map from names to multiaddrs. Besides its
+// use in tests, it serves as a template for handlers of custom naming protocols registered with
+// RegisterResolvable.
+type MockHandler struct {
+	Addrs map[string][]ma.Multiaddr
+}
+
+// Resolve returns the multiaddrs registered for name, or no multiaddrs if there are none.
+func (h *MockHandler) Resolve(ctx context.Context, name string) ([]ma.Multiaddr, error) {
+	return h.Addrs[name], nil
+}
+
+// Kinds of lookups recorded by a RecordingResolver.
+const (
+	LookupKindIPAddr = "ipaddr"
+	LookupKindTXT    = "txt"
+)
+
+// Lookup is a single lookup recorded by a RecordingResolver.
+type Lookup struct {
+	Kind string
+	Name string
+}
+
+// RecordingResolver is a BasicResolver that records every lookup made through it, in order,
+// before delegating it to Resolver. It is meant for tests that check which queries a
+// resolution performs.
+type RecordingResolver struct {
+	Resolver BasicResolver
+
+	mu      sync.Mutex
+	lookups []Lookup
+}
+
+var _ BasicResolver = (*RecordingResolver)(nil)
+
+func (r *RecordingResolver) LookupIPAddr(ctx context.Context, name string) ([]net.IPAddr, error) {
+	r.record(LookupKindIPAddr, name)
+	return r.Resolver.LookupIPAddr(ctx, name)
+}
+
+func (r *RecordingResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	r.record(LookupKindTXT, name)
+	return r.Resolver.LookupTXT(ctx, name)
+}
+
+// Lookups returns the lookups recorded so far.
+func (r *RecordingResolver) Lookups() []Lookup {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Lookup(nil), r.lookups...)
+}
+
+func (r *RecordingResolver) record(kind, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups = append(r.lookups, Lookup{Kind: kind, Name: name})
+}
+
+// DelayResolver is a BasicResolver that waits before delegating every lookup to Resolver, to
+// exercise timeouts in tests without depending on a real network. Each lookup waits for Delay
+// plus a random duration below Jitter, and fails with the context's error if the context is done
+// first.
+type DelayResolver struct {
+	Resolver BasicResolver
+	Delay    time.Duration
+	Jitter   time.Duration
+}
+
+var _ BasicResolver = (*DelayResolver)(nil)
+
+func (r *DelayResolver) LookupIPAddr(ctx context.Context, name string) ([]net.IPAddr, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.Resolver.LookupIPAddr(ctx, name)
+}
+
+func (r *DelayResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if err := r.wait(ctx); err != nil {
+		return nil, err
+	}
+	return r.Resolver.LookupTXT(ctx, name)
+}
+
+func (r *DelayResolver) wait(ctx context.Context) error {
+	d := r.Delay
+	if r.Jitter > 0 {
+		d += rand.N(r.Jitter)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
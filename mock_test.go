@@ -0,0 +1,182 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestMockResolverWildcard(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"exact.example.com":    {ip4a},
+			"*.example.com":        {ip4b},
+			"*.nested.example.com": {ip6a},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta},
+			"*":                    {txtb},
+		},
+	}
+	ctx := context.Background()
+
+	for name, expected := range map[string]net.IPAddr{
+		"exact.example.com":      ip4a,
+		"other.example.com":      ip4b,
+		"a.b.example.com":        ip4b,
+		"a.nested.example.com":   ip6a,
+		"a.b.nested.example.com": ip6a,
+		"nested.example.com":     ip4b,
+	} {
+		res, err := mock.LookupIPAddr(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || !res[0].IP.Equal(expected.IP) {
+			t.Fatalf("%s: expected [%s], got %+v", name, expected, res)
+		}
+	}
+
+	res, err := mock.LookupIPAddr(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("expected the wildcard not to match its parent, got %+v", res)
+	}
+
+	txts, err := mock.LookupTXT(ctx, "_dnsaddr.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txts) != 1 || txts[0] != txta {
+		t.Fatalf("expected [%s], got %+v", txta, txts)
+	}
+	txts, err = mock.LookupTXT(ctx, "_dnsaddr.anything.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txts) != 1 || txts[0] != txtb {
+		t.Fatalf("expected [%s], got %+v", txtb, txts)
+	}
+}
+
+func TestMockResolverCaseInsensitive(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com":    {ip4a},
+			"Upper.Example.": {ip6a},
+			"*.wild.example": {ip4b},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta},
+		},
+	}
+	ctx := context.Background()
+
+	for name, expected := range map[string]net.IPAddr{
+		"Example.com":     ip4a,
+		"EXAMPLE.COM.":    ip4a,
+		"example.com.":    ip4a,
+		"upper.example":   ip6a,
+		"UPPER.example.":  ip6a,
+		"A.Wild.Example":  ip4b,
+		"a.wild.example.": ip4b,
+	} {
+		res, err := mock.LookupIPAddr(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || !res[0].IP.Equal(expected.IP) {
+			t.Fatalf("%s: expected [%s], got %+v", name, expected, res)
+		}
+	}
+
+	txts, err := mock.LookupTXT(ctx, "_DNSADDR.Example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txts) != 1 || txts[0] != txta {
+		t.Fatalf("expected [%s], got %+v", txta, txts)
+	}
+
+	res, err := mock.LookupIPAddr(ctx, "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 0 {
+		t.Fatalf("expected no records, got %+v", res)
+	}
+}
+
+func TestMockResolverChanges(t *testing.T) {
+	mock := &MockResolver{IP: map[string][]net.IPAddr{"example.com": {ip4a}}}
+	ctx := context.Background()
+	if res, err := mock.LookupIPAddr(ctx, "Example.com"); err != nil || len(res) != 1 {
+		t.Fatalf("expected one address, got %+v, %v", res, err)
+	}
+
+	// Changes made after a lookup are seen by the next one.
+	mock.IP["Other.com."] = []net.IPAddr{ip4b}
+	delete(mock.IP, "example.com")
+	res, err := mock.LookupIPAddr(ctx, "other.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || !res[0].IP.Equal(ip4b.IP) {
+		t.Fatalf("expected [%s], got %+v", ip4b, res)
+	}
+	if res, err := mock.LookupIPAddr(ctx, "Example.com"); err != nil || len(res) != 0 {
+		t.Fatalf("expected no addresses, got %+v, %v", res, err)
+	}
+}
+
+func TestMockResolverCollidingNames(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"Example.com":  {ip4a},
+			"example.com.": {ip4b},
+		},
+	}
+	ctx := context.Background()
+	if _, err := mock.LookupIPAddr(ctx, "example.com"); err == nil {
+		t.Fatal("expected names normalizing to the same one to be an error")
+	}
+	// Only lookups of the colliding name fail.
+	if _, err := mock.LookupIPAddr(ctx, "other.com"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDelayResolverTimeout(t *testing.T) {
+	slow := &DelayResolver{Resolver: makeResolver().def, Delay: 50 * time.Millisecond, Jitter: 10 * time.Millisecond}
+	resolver, err := NewResolver(WithDefaultResolver(slow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	maddr := ma.StringCast("/dnsaddr/example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := resolver.Resolve(ctx, maddr); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the lookup to time out, got %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	addrs, err := resolver.Resolve(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < slow.Delay {
+		t.Fatalf("expected the lookup to take at least %s, took %s", slow.Delay, took)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 addresses, got %+v", addrs)
+	}
+}
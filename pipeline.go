@@ -0,0 +1,82 @@
+package madns
+
+import (
+	"context"
+	"slices"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ResultStage is a step of a result pipeline, transforming the addresses resolved by Resolve.
+type ResultStage func(ctx context.Context, addrs []ma.Multiaddr) ([]ma.Multiaddr, error)
+
+// WithResultPipeline is an option that passes the addresses resolved by Resolve through the
+// given stages, in order. An error from any stage fails the resolution.
+func WithResultPipeline(stages ...ResultStage) Option {
+	return func(r *Resolver) error {
+		r.pipeline = append(r.pipeline, stages...)
+		return nil
+	}
+}
+
+func (r *Resolver) runPipeline(ctx context.Context, addrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
+	for _, stage := range r.pipeline {
+		var err error
+		addrs, err = stage(ctx, addrs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return addrs, nil
+}
+
+// Dedup is a ResultStage that removes duplicate addresses, keeping the first occurrence.
+func Dedup(_ context.Context, addrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
+	seen := make(map[string]struct{}, len(addrs))
+	unique := addrs[:0]
+	for _, addr := range addrs {
+		key := string(addr.Bytes())
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, addr)
+	}
+	return unique, nil
+}
+
+// SortByFamily is a ResultStage that sorts addresses starting with /ip4 ahead of those starting
+// with /ip6, followed by any others. The order within each group is preserved.
+func SortByFamily(_ context.Context, addrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
+	family := func(addr ma.Multiaddr) int {
+		ip := leadingIP(addr)
+		switch {
+		case ip == nil:
+			return 2
+		case ip.To4() != nil:
+			return 0
+		default:
+			return 1
+		}
+	}
+	slices.SortStableFunc(addrs, func(a, b ma.Multiaddr) int {
+		return family(a) - family(b)
+	})
+	return addrs, nil
+}
+
+// FilterPrivate is a ResultStage that drops addresses within PrivateRanges.
+func FilterPrivate(_ context.Context, addrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
+	return dropInRanges(addrs, PrivateRanges), nil
+}
+
+// Cap returns a ResultStage that keeps at most the first n addresses. A negative n keeps none.
+func Cap(n int) ResultStage {
+	n = max(n, 0)
+	return func(_ context.Context, addrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
+		if len(addrs) > n {
+			addrs = addrs[:n]
+		}
+		return addrs, nil
+	}
+}
@@ -0,0 +1,82 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestResultPipeline(t *testing.T) {
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/ip6/2001:db8::a3/tcp/1",
+				"dnsaddr=/ip4/10.0.0.1/tcp/1",
+				"dnsaddr=/ip4/192.0.2.1/tcp/1",
+				"dnsaddr=/dns4/example.com/tcp/1",
+				"dnsaddr=/ip6/2001:db8::a3/tcp/1",
+				"dnsaddr=/ip4/192.0.2.2/tcp/1",
+			},
+		},
+	}
+	ctx := context.Background()
+	maddr := ma.StringCast("/dnsaddr/example.com")
+
+	for _, tc := range []struct {
+		stages   []ResultStage
+		expected []string
+	}{
+		{
+			[]ResultStage{Dedup, FilterPrivate, SortByFamily},
+			[]string{"/ip4/192.0.2.1/tcp/1", "/ip4/192.0.2.2/tcp/1", "/ip6/2001:db8::a3/tcp/1", "/dns4/example.com/tcp/1"},
+		},
+		{
+			[]ResultStage{SortByFamily, Cap(3), Dedup},
+			[]string{"/ip4/10.0.0.1/tcp/1", "/ip4/192.0.2.1/tcp/1", "/ip4/192.0.2.2/tcp/1"},
+		},
+		{
+			[]ResultStage{Cap(2), SortByFamily},
+			[]string{"/ip4/10.0.0.1/tcp/1", "/ip6/2001:db8::a3/tcp/1"},
+		},
+		{
+			[]ResultStage{Cap(-1)},
+			nil,
+		},
+	} {
+		resolver, err := NewResolver(WithDefaultResolver(mock), WithResultPipeline(tc.stages...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := resolver.Resolve(ctx, maddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("expected %+v, got %+v", tc.expected, addrs)
+		}
+		for i, e := range tc.expected {
+			if addrs[i].String() != e {
+				t.Fatalf("%d: expected %s, got %s", i, e, addrs[i])
+			}
+		}
+	}
+}
+
+func TestResultPipelineError(t *testing.T) {
+	errStage := errors.New("rejected")
+	resolver, err := NewResolver(
+		WithDefaultResolver(&MockResolver{IP: map[string][]net.IPAddr{"example.com": {ip4a}}}),
+		WithResultPipeline(func(context.Context, []ma.Multiaddr) ([]ma.Multiaddr, error) {
+			return nil, errStage
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.Resolve(context.Background(), ma.StringCast("/dns4/example.com")); !errors.Is(err, errStage) {
+		t.Fatalf("expected the stage error, got %v", err)
+	}
+}
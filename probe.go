@@ -0,0 +1,115 @@
+package madns
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ProbeFunc measures how long it takes to reach addr, returning an error if it can't be reached.
+type ProbeFunc func(ctx context.Context, addr ma.Multiaddr) (time.Duration, error)
+
+// WithReachabilityProbe is an option that probes every resolved address concurrently and sorts
+// the results by measured latency, fastest first. Addresses that fail to respond within timeout
+// are sorted last, in their original order. The probe must return once its context is done, and
+// timeout must be positive.
+//
+// Only fully resolved addresses are probed. Addresses with components left to resolve, like the
+// ones ResolveAll passes between rounds, are sorted with the unreachable ones without probing.
+// As every call to Resolve sorts its own results, ResolveAll returns them sorted per round rather
+// than as a whole.
+func WithReachabilityProbe(probe ProbeFunc, timeout time.Duration) Option {
+	return func(r *Resolver) error {
+		if probe == nil {
+			return errors.New("nil reachability probe")
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("invalid reachability probe timeout %s", timeout)
+		}
+		r.probe = probe
+		r.probeTimeout = timeout
+		return nil
+	}
+}
+
+func (r *Resolver) sortByReachability(ctx context.Context, addrs []ma.Multiaddr) []ma.Multiaddr {
+	ctx, cancel := context.WithTimeout(ctx, r.probeTimeout)
+	defer cancel()
+
+	type probed struct {
+		addr      ma.Multiaddr
+		rtt       time.Duration
+		reachable bool
+	}
+	results := make([]probed, len(addrs))
+
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		if Matches(addr) {
+			results[i] = probed{addr: addr}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rtt, err := r.probe(ctx, addr)
+			results[i] = probed{addr: addr, rtt: rtt, reachable: err == nil && ctx.Err() == nil}
+		}()
+	}
+	wg.Wait()
+
+	slices.SortStableFunc(results, func(a, b probed) int {
+		switch {
+		case a.reachable && b.reachable:
+			return cmp.Compare(a.rtt, b.rtt)
+		case a.reachable:
+			return -1
+		case b.reachable:
+			return 1
+		default:
+			return 0
+		}
+	})
+	for i := range results {
+		addrs[i] = results[i].addr
+	}
+	return addrs
+}
+
+// ScoreFunc scores an address, higher scores being more likely to connect.
+type ScoreFunc func(addr ma.Multiaddr) int
+
+// WithScorer is an option that sorts the resolved addresses by score, highest first, keeping the
+// original order of addresses with the same score. It lets callers apply what they know about
+// addresses without probing them. Combined with WithReachabilityProbe, addresses are sorted by
+// score first and latency second. Sorting happens before the result pipeline runs.
+func WithScorer(score ScoreFunc) Option {
+	return func(r *Resolver) error {
+		r.scorer = score
+		return nil
+	}
+}
+
+func (r *Resolver) sortByScore(addrs []ma.Multiaddr) []ma.Multiaddr {
+	type scored struct {
+		addr  ma.Multiaddr
+		score int
+	}
+	results := make([]scored, len(addrs))
+	for i, addr := range addrs {
+		results[i] = scored{addr: addr, score: r.scorer(addr)}
+	}
+	slices.SortStableFunc(results, func(a, b scored) int {
+		return cmp.Compare(b.score, a.score)
+	})
+	for i := range results {
+		addrs[i] = results[i].addr
+	}
+	return addrs
+}
@@ -0,0 +1,153 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestReachabilityProbe(t *testing.T) {
+	ip4c := net.IPAddr{IP: net.ParseIP("192.0.2.3")}
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip4a, ip4b, ip4c, ip6a, ip6b},
+		},
+	}
+	rtts := map[string]time.Duration{
+		ip4b.IP.String(): 30 * time.Millisecond,
+		ip6a.IP.String(): 10 * time.Millisecond,
+		ip6b.IP.String(): 20 * time.Millisecond,
+	}
+	probe := func(ctx context.Context, addr ma.Multiaddr) (time.Duration, error) {
+		ip := leadingIP(addr).String()
+		switch ip {
+		case ip4a.IP.String():
+			return 0, errors.New("connection refused")
+		case ip4c.IP.String():
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return rtts[ip], nil
+	}
+
+	resolver, err := NewResolver(
+		WithDefaultResolver(mock),
+		WithReachabilityProbe(probe, 50*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := resolver.Resolve(context.Background(), ma.StringCast("/dns/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []net.IPAddr{ip6a, ip6b, ip4b, ip4a, ip4c}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %d addresses, got %+v", len(expected), addrs)
+	}
+	for i, e := range expected {
+		if ip := leadingIP(addrs[i]); !ip.Equal(e.IP) {
+			t.Fatalf("%d: expected %s, got %s", i, e.IP, ip)
+		}
+	}
+}
+
+func TestReachabilityProbePartial(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"a.com": {ip4a},
+			"b.com": {ip4b},
+		},
+	}
+	var mu sync.Mutex
+	var probed []string
+	probe := func(ctx context.Context, addr ma.Multiaddr) (time.Duration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		probed = append(probed, addr.String())
+		return time.Millisecond, nil
+	}
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithReachabilityProbe(probe, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dns4/a.com/tcp/1/dns4/b.com/tcp/2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "/ip4/192.0.2.1/tcp/1/ip4/192.0.2.2/tcp/2"
+	if len(addrs) != 1 || addrs[0].String() != expected {
+		t.Fatalf("expected [%s], got %+v", expected, addrs)
+	}
+	if len(probed) != 1 || probed[0] != expected {
+		t.Fatalf("expected only the fully resolved address to be probed, got %v", probed)
+	}
+}
+
+func TestReachabilityProbeOptions(t *testing.T) {
+	probe := func(context.Context, ma.Multiaddr) (time.Duration, error) { return 0, nil }
+	if _, err := NewResolver(WithReachabilityProbe(nil, time.Second)); err == nil {
+		t.Fatal("expected a nil probe to be rejected")
+	}
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		if _, err := NewResolver(WithReachabilityProbe(probe, timeout)); err == nil {
+			t.Fatalf("expected a timeout of %s to be rejected", timeout)
+		}
+	}
+}
+
+func TestScorer(t *testing.T) {
+	ip4c := net.IPAddr{IP: net.ParseIP("198.51.100.7")}
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip4a, ip4b, ip6a, ip4c, ip6b},
+		},
+	}
+	_, preferred, _ := net.ParseCIDR("198.51.100.0/24")
+	score := func(addr ma.Multiaddr) int {
+		ip := leadingIP(addr)
+		switch {
+		case preferred.Contains(ip):
+			return 10
+		case ip.To4() == nil:
+			return 1
+		default:
+			return 0
+		}
+	}
+	resolver, err := NewResolver(
+		WithDefaultResolver(mock),
+		WithScorer(score),
+		WithResultPipeline(Cap(4)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := resolver.Resolve(context.Background(), ma.StringCast("/dns/example.com/tcp/1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pipeline caps the sorted addresses, dropping the lowest scored.
+	expected := []string{
+		"/ip4/198.51.100.7/tcp/1",
+		"/ip6/2001:db8::a3/tcp/1",
+		"/ip6/2001:db8::a4/tcp/1",
+		"/ip4/192.0.2.1/tcp/1",
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %v, got %+v", expected, addrs)
+	}
+	for i, e := range expected {
+		if addrs[i].String() != e {
+			t.Fatalf("expected %s at %d, got %s", e, i, addrs[i])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// defaultProxyTTL is the TTL of the records served by a DNSProxy without one.
+const defaultProxyTTL = 60
+
+// DNSProxy is a dns.Handler that answers queries with a Resolver, so that tools which only speak
+// DNS benefit from its static overrides, filters and per-domain resolvers.
+//
+// A and AAAA queries are answered with the addresses the name resolves to as /dns4 and /dns6
+// components. TXT queries for _dnsaddr names are answered with the records /dnsaddr resolves to,
+// and other TXT queries are passed through to the resolver responsible for the name. Other query
+// types are answered with NOTIMP. UDP answers too large for the client are truncated, so that it
+// retries over TCP.
+type DNSProxy struct {
+	Resolver *Resolver
+	// TTL is the TTL of the records served, in seconds. Defaults to 60.
+	TTL uint32
+	// Timeout bounds the time spent resolving a query. Zero means no timeout.
+	Timeout time.Duration
+}
+
+var _ dns.Handler = (*DNSProxy)(nil)
+
+func (p *DNSProxy) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	m.RecursionAvailable = true
+
+	if len(req.Question) != 1 || req.Question[0].Qclass != dns.ClassINET {
+		m.Rcode = dns.RcodeNotImplemented
+		_ = w.WriteMsg(m)
+		return
+	}
+	q := req.Question[0]
+
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	answers, err := p.answer(ctx, q)
+	switch {
+	case errors.Is(err, errNotImplemented):
+		m.Rcode = dns.RcodeNotImplemented
+	case isNotFound(err):
+		m.Rcode = dns.RcodeNameError
+	case err != nil:
+		m.Rcode = dns.RcodeServerFailure
+	default:
+		m.Answer = answers
+	}
+	// Answers too large for the client are truncated, setting the TC bit so that it retries
+	// over TCP.
+	size := dns.MinMsgSize
+	if _, ok := w.RemoteAddr().(*net.TCPAddr); ok {
+		size = dns.MaxMsgSize
+	} else if opt := req.IsEdns0(); opt != nil {
+		size = int(opt.UDPSize())
+		m.SetEdns0(opt.UDPSize(), false)
+	}
+	m.Truncate(size)
+	_ = w.WriteMsg(m)
+}
+
+var errNotImplemented = errors.New("query type not implemented")
+
+func (p *DNSProxy) answer(ctx context.Context, q dns.Question) ([]dns.RR, error) {
+	name := strings.TrimSuffix(q.Name, ".")
+	hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: p.ttl()}
+
+	switch q.Qtype {
+	case dns.TypeA, dns.TypeAAAA:
+		proto := "dns4"
+		if q.Qtype == dns.TypeAAAA {
+			proto = "dns6"
+		}
+		c, err := ma.NewComponent(proto, name)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := p.Resolver.Resolve(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		var answers []dns.RR
+		for _, addr := range addrs {
+			// /dns4 may resolve to /ip6 addresses with WithDNS64.
+			ip := leadingIP(addr)
+			switch {
+			case ip == nil:
+			case q.Qtype == dns.TypeA && ip.To4() != nil:
+				answers = append(answers, &dns.A{Hdr: hdr, A: ip})
+			case q.Qtype == dns.TypeAAAA && ip.To4() == nil:
+				answers = append(answers, &dns.AAAA{Hdr: hdr, AAAA: ip})
+			}
+		}
+		return answers, nil
+	case dns.TypeTXT:
+		var records []string
+		if domain, ok := strings.CutPrefix(name, "_dnsaddr."); ok {
+			c, err := ma.NewComponent("dnsaddr", domain)
+			if err != nil {
+				return nil, err
+			}
+			addrs, err := p.Resolver.Resolve(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+			for _, addr := range addrs {
+				records = append(records, dnsaddrTXTPrefix+addr.String())
+			}
+		} else {
+			var err error
+			records, err = p.Resolver.LookupTXT(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+		}
+		answers := make([]dns.RR, 0, len(records))
+		for _, txt := range records {
+			answers = append(answers, &dns.TXT{Hdr: hdr, Txt: splitTXT(txt)})
+		}
+		return answers, nil
+	default:
+		return nil, errNotImplemented
+	}
+}
+
+func (p *DNSProxy) ttl() uint32 {
+	if p.TTL == 0 {
+		return defaultProxyTTL
+	}
+	return p.TTL
+}
+
+// maxTXTStringLen is the maximum length of a character-string in a TXT record.
+const maxTXTStringLen = 255
+
+// splitTXT splits txt into the character-strings of a TXT record, which clients join back
+// together.
+func splitTXT(txt string) []string {
+	var chunks []string
+	for len(txt) > maxTXTStringLen {
+		chunks = append(chunks, txt[:maxTXTStringLen])
+		txt = txt[maxTXTStringLen:]
+	}
+	return append(chunks, txt)
+}
@@ -0,0 +1,185 @@
+package madns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func queryProxy(t *testing.T, addr, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	res, _, err := new(dns.Client).Exchange(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestDNSProxy(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip4a, ip6a, {IP: net.ParseIP("10.0.0.1")}},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta, "not a dnsaddr", txtc},
+			"example.com":          {"v=spf1 -all"},
+		},
+	}
+	resolver, err := NewResolver(
+		WithDefaultResolver(mock),
+		WithDomainResolver("missing.test", &ZoneResolver{}),
+		WithDomainResolver("failing.test", &failingResolver{}),
+		WithDropPrivateRanges(),
+		WithStaticOverrides(map[string][]ma.Multiaddr{"pinned.com": {ip4mb}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startDNSServer(t, &DNSProxy{Resolver: resolver, TTL: 30})
+	query := func(name string, qtype uint16) *dns.Msg {
+		t.Helper()
+		return queryProxy(t, addr, name, qtype)
+	}
+
+	res := query("example.com", dns.TypeA)
+	if res.Rcode != dns.RcodeSuccess || len(res.Answer) != 1 {
+		t.Fatalf("expected a single A record, got %v", res)
+	}
+	if a := res.Answer[0].(*dns.A); !a.A.Equal(ip4a.IP) || a.Hdr.Ttl != 30 {
+		t.Fatalf("unexpected answer %v", a)
+	}
+
+	res = query("example.com", dns.TypeAAAA)
+	if len(res.Answer) != 1 || !res.Answer[0].(*dns.AAAA).AAAA.Equal(ip6a.IP) {
+		t.Fatalf("expected [%s], got %v", ip6a.IP, res.Answer)
+	}
+
+	res = query("pinned.com", dns.TypeA)
+	if len(res.Answer) != 1 || !res.Answer[0].(*dns.A).A.Equal(ip4b.IP) {
+		t.Fatalf("expected the static override, got %v", res.Answer)
+	}
+
+	res = query("_dnsaddr.example.com", dns.TypeTXT)
+	expected := []string{txta, txtc}
+	if len(res.Answer) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, res.Answer)
+	}
+	for i, e := range expected {
+		if txt := res.Answer[i].(*dns.TXT).Txt; len(txt) != 1 || txt[0] != e {
+			t.Fatalf("expected %s at %d, got %v", e, i, txt)
+		}
+	}
+
+	res = query("example.com", dns.TypeTXT)
+	if len(res.Answer) != 1 || res.Answer[0].(*dns.TXT).Txt[0] != "v=spf1 -all" {
+		t.Fatalf("expected the TXT record to be passed through, got %v", res.Answer)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		qtype uint16
+		rcode int
+	}{
+		{"missing.test", dns.TypeA, dns.RcodeNameError},
+		{"failing.test", dns.TypeAAAA, dns.RcodeServerFailure},
+		{"example.com", dns.TypeMX, dns.RcodeNotImplemented},
+	} {
+		if res := query(tc.name, tc.qtype); res.Rcode != tc.rcode {
+			t.Fatalf("%s %s: expected %s, got %s", tc.name, dns.TypeToString[tc.qtype],
+				dns.RcodeToString[tc.rcode], dns.RcodeToString[res.Rcode])
+		}
+	}
+}
+
+func TestDNSProxyLongTXT(t *testing.T) {
+	const (
+		certa = "/certhash/uEiDDq4_xNyDorZBH3TlGazyJdOWSwvo4PUo5YHFMrvDE8g"
+		certb = "/certhash/uEiAkH5a4DPGKUuOBjYw0CgwjvcJCJMD2K_1aluKR_tpevQ"
+		p2p   = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	)
+	wt := "dnsaddr=/ip6/2001:db8::a3/udp/443/quic-v1/webtransport" + certa + certb + certa + p2p
+	if len(wt) <= 255 {
+		t.Fatalf("expected a record longer than a TXT character-string, got %d bytes", len(wt))
+	}
+	resolver, err := NewResolver(WithDefaultResolver(&MockResolver{
+		TXT: map[string][]string{"_dnsaddr.example.com": {wt, txta}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startDNSServer(t, &DNSProxy{Resolver: resolver})
+
+	res := queryProxy(t, addr, "_dnsaddr.example.com", dns.TypeTXT)
+	if res.Rcode != dns.RcodeSuccess || len(res.Answer) != 2 {
+		t.Fatalf("expected two TXT records, got %v", res)
+	}
+	for i, e := range []string{wt, txta} {
+		txt := res.Answer[i].(*dns.TXT).Txt
+		if strings.Join(txt, "") != e {
+			t.Fatalf("expected %s at %d, got %v", e, i, txt)
+		}
+		for _, s := range txt {
+			if len(s) > 255 {
+				t.Fatalf("expected character-strings of at most 255 bytes, got %d", len(s))
+			}
+		}
+	}
+}
+
+func TestDNSProxyDNS64(t *testing.T) {
+	resolver, err := NewResolver(
+		WithDefaultResolver(&MockResolver{IP: map[string][]net.IPAddr{"v4only.com": {ip4a}}}),
+		WithDNS64(WellKnownNAT64Prefix),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startDNSServer(t, &DNSProxy{Resolver: resolver})
+
+	res := queryProxy(t, addr, "v4only.com", dns.TypeA)
+	if res.Rcode != dns.RcodeSuccess || len(res.Answer) != 0 {
+		t.Fatalf("expected no A records for synthesized addresses, got %v", res.Answer)
+	}
+	res = queryProxy(t, addr, "v4only.com", dns.TypeAAAA)
+	expected := net.ParseIP("64:ff9b::c000:201")
+	if len(res.Answer) != 1 || !res.Answer[0].(*dns.AAAA).AAAA.Equal(expected) {
+		t.Fatalf("expected [%s], got %v", expected, res.Answer)
+	}
+}
+
+func TestDNSProxyTruncate(t *testing.T) {
+	var records []string
+	for i := 0; i < 20; i++ {
+		records = append(records, fmt.Sprintf("dnsaddr=/ip4/192.0.2.%d/tcp/4001", i+1))
+	}
+	resolver, err := NewResolver(WithDefaultResolver(&MockResolver{
+		TXT: map[string][]string{"_dnsaddr.example.com": records},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startDNSServer(t, &DNSProxy{Resolver: resolver})
+
+	res := queryProxy(t, addr, "_dnsaddr.example.com", dns.TypeTXT)
+	if !res.Truncated || len(res.Answer) >= len(records) {
+		t.Fatalf("expected a truncated answer, got %d records, truncated: %v", len(res.Answer), res.Truncated)
+	}
+
+	// Clients advertising a larger buffer get the whole answer.
+	m := new(dns.Msg)
+	m.SetQuestion("_dnsaddr.example.com.", dns.TypeTXT)
+	m.SetEdns0(4096, false)
+	res, _, err = new(dns.Client).Exchange(m, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Truncated || len(res.Answer) != len(records) {
+		t.Fatalf("expected %d records, got %d, truncated: %v", len(records), len(res.Answer), res.Truncated)
+	}
+}
@@ -0,0 +1,68 @@
+package madns
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ResolveHandler resolves the value of a custom resolvable protocol component into the
+// multiaddrs it stands for.
+type ResolveHandler func(ctx context.Context, value string) ([]ma.Multiaddr, error)
+
+var (
+	handlersMu sync.RWMutex
+	handlers   = make(map[int]ResolveHandler)
+)
+
+// RegisterResolvable registers a handler for a custom, name-based protocol so that Matches and
+// Resolve treat components of that protocol as resolvable. The results of the handler are
+// encapsulated and capped like those of the built-in dns protocols.
+//
+// The built-in dns, dns4, dns6 and dnsaddr protocols cannot be overridden, and a protocol can
+// only be registered once, with a non-nil handler. Handlers should be registered during initialization, as
+// ResolvableProtocols is not safe for concurrent modification.
+func RegisterResolvable(proto ma.Protocol, handler ResolveHandler) error {
+	if isDNSProtocol(proto.Code) {
+		return fmt.Errorf("cannot override the handler of built-in protocol %s", proto.Name)
+	}
+	if handler == nil {
+		return fmt.Errorf("nil handler for protocol %s", proto.Name)
+	}
+
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+
+	if _, ok := handlers[proto.Code]; ok {
+		return fmt.Errorf("protocol %s is already registered as resolvable", proto.Name)
+	}
+	handlers[proto.Code] = handler
+	ResolvableProtocols = append(ResolvableProtocols, proto)
+	return nil
+}
+
+func getHandler(code int) (ResolveHandler, bool) {
+	handlersMu.RLock()
+	defer handlersMu.RUnlock()
+	h, ok := handlers[code]
+	return h, ok
+}
+
+func isDNSProtocol(code int) bool {
+	switch code {
+	case dnsProtocol.Code, dns4Protocol.Code, dns6Protocol.Code, dnsaddrProtocol.Code:
+		return true
+	default:
+		return false
+	}
+}
+
+func isResolvable(code int) bool {
+	if isDNSProtocol(code) {
+		return true
+	}
+	_, ok := getHandler(code)
+	return ok
+}
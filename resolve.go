@@ -2,11 +2,17 @@ package madns
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 )
 
 var (
@@ -21,10 +27,39 @@ var (
 	DefaultResolver     = &Resolver{def: net.DefaultResolver}
 )
 
+// ErrPortInDomain is returned when the domain of a dns component carries a port, as in
+// /dns4/example.com:4001, which isn't a valid way to specify one.
+var ErrPortInDomain = errors.New("dns component includes a port")
+
+// ErrInsufficientAddrs is returned when a multiaddr resolves to fewer addresses than required by
+// WithMinResolvedAddrs.
+var ErrInsufficientAddrs = errors.New("insufficient resolved addresses")
+
+// ErrNoResolvableAddrs is returned by Validate when a multiaddr doesn't resolve to any address,
+// and by Resolve when a component resolves to no address and WithErrorOnEmpty is set.
+var ErrNoResolvableAddrs = errors.New("multiaddr does not resolve to any address")
+
+// ErrTooManyHops is returned when a multiaddr contains more resolvable components than allowed
+// by WithMaxDNSHops.
+var ErrTooManyHops = errors.New("too many resolvable components")
+
 const maxResolvedAddrs = 100
 
+// defaultMaxDNSHops is the number of resolvable components allowed in a multiaddr without
+// WithMaxDNSHops.
+const defaultMaxDNSHops = 16
+
+// maxResolveDepth bounds the number of rounds of resolution performed by ResolveAll.
+const maxResolveDepth = 32
+
+// defaultMaxConcurrency is the default number of addresses ResolveAll resolves at once.
+const defaultMaxConcurrency = 8
+
 const dnsaddrTXTPrefix = "dnsaddr="
 
+// defaultMaxTXTRecordLen is the default length limit of a single dnsaddr TXT record.
+const defaultMaxTXTRecordLen = 2048
+
 // BasicResolver is a low level interface for DNS resolution
 type BasicResolver interface {
 	LookupIPAddr(context.Context, string) ([]net.IPAddr, error)
@@ -38,6 +73,51 @@ type BasicResolver interface {
 type Resolver struct {
 	def    BasicResolver
 	custom map[string]BasicResolver
+
+	// per-family resolvers, used instead of def when set.
+	ipv4 BasicResolver
+	ipv6 BasicResolver
+
+	static map[string][]ma.Multiaddr
+
+	maxTXTBytes     int
+	maxTXTRecordLen int
+	minAddrs        int
+	maxConcurrency  int
+	maxCrossProduct int
+	maxDNSHops      int
+
+	emptyRetries    int
+	emptyRetryDelay time.Duration
+
+	stripPeerIDs        bool
+	preferPeerIDs       bool
+	preferPeerIDsStrict bool
+	dnsaddrQueryApex    bool
+	dnsaddrUnmapIPv4    bool
+
+	preserveDomainCase bool
+
+	dnsaddrTransports []int
+	txtValidator      TXTRecordValidator
+	defaultPort       *ma.Component
+	dropRanges        []*net.IPNet
+	dns64             *net.IPNet
+
+	lenientPortSuffix bool
+
+	notFoundMatcher     func(error) bool
+	errorOnEmpty        bool
+	rebindingProtection bool
+	rebindingStrict     bool
+
+	stats stats
+
+	probe        ProbeFunc
+	probeTimeout time.Duration
+	scorer       ScoreFunc
+
+	pipeline []ResultStage
 }
 
 var _ BasicResolver = (*Resolver)(nil)
@@ -69,9 +149,12 @@ func WithDefaultResolver(def BasicResolver) Option {
 
 // WithDomainResolver specifies a custom resolver for a domain/TLD.
 // Custom resolver selection matches domains left to right, with more specific resolvers
-// superseding generic ones.
+// superseding generic ones. The domain must be a well-formed DNS name.
 func WithDomainResolver(domain string, rslv BasicResolver) Option {
 	return func(r *Resolver) error {
+		if err := checkDomain(domain); err != nil {
+			return err
+		}
 		if r.custom == nil {
 			r.custom = make(map[string]BasicResolver)
 		}
@@ -81,7 +164,347 @@ func WithDomainResolver(domain string, rslv BasicResolver) Option {
 	}
 }
 
-func (r *Resolver) getResolver(domain string) BasicResolver {
+// WithIPv4Resolver is an option that specifies the basic resolver used for IPv4 lookups of any
+// domain that doesn't have a custom resolver. /dns4 components are resolved with it alone, while
+// /dns components are resolved with both it and the IPv6 resolver.
+func WithIPv4Resolver(rslv BasicResolver) Option {
+	return func(r *Resolver) error {
+		r.ipv4 = rslv
+		return nil
+	}
+}
+
+// WithIPv6Resolver is an option that specifies the basic resolver used for IPv6 lookups of any
+// domain that doesn't have a custom resolver. /dns6 components are resolved with it alone, while
+// /dns components are resolved with both it and the IPv4 resolver.
+func WithIPv6Resolver(rslv BasicResolver) Option {
+	return func(r *Resolver) error {
+		r.ipv6 = rslv
+		return nil
+	}
+}
+
+// WithStaticOverrides is an option that short-circuits the resolution of the listed domains:
+// a /dns, /dns4, /dns6 or /dnsaddr component naming one of them resolves to the configured
+// multiaddrs without querying any resolver. Other domains are resolved as usual. For /dnsaddr,
+// the multiaddrs stand in for the TXT records, and are matched against the rest of the multiaddr
+// like them.
+func WithStaticOverrides(overrides map[string][]ma.Multiaddr) Option {
+	return func(r *Resolver) error {
+		if r.static == nil {
+			r.static = make(map[string][]ma.Multiaddr, len(overrides))
+		}
+		for domain, addrs := range overrides {
+			r.static[staticKey(domain)] = addrs
+		}
+		return nil
+	}
+}
+
+func staticKey(domain string) string {
+	return strings.ToLower(dns.Fqdn(domain))
+}
+
+// WithMaxTXTBytes is an option that bounds the total size of the TXT records processed when
+// resolving a /dnsaddr component. Records past the point where the budget runs out are ignored,
+// and reported with ErrTXTBudgetExceeded by ResolveWithMeta. Defaults to 0, for no limit.
+func WithMaxTXTBytes(n int) Option {
+	return func(r *Resolver) error {
+		if n < 0 {
+			return fmt.Errorf("invalid max TXT bytes %d", n)
+		}
+		r.maxTXTBytes = n
+		return nil
+	}
+}
+
+// WithMaxTXTRecordLen is an option that bounds the length of a single dnsaddr TXT record. Longer
+// records are skipped without being parsed. Defaults to 2048 bytes.
+func WithMaxTXTRecordLen(n int) Option {
+	return func(r *Resolver) error {
+		if n < 1 {
+			return fmt.Errorf("invalid max TXT record length %d", n)
+		}
+		r.maxTXTRecordLen = n
+		return nil
+	}
+}
+
+func (r *Resolver) txtRecordLimit() int {
+	if r.maxTXTRecordLen == 0 {
+		return defaultMaxTXTRecordLen
+	}
+	return r.maxTXTRecordLen
+}
+
+// WithMinResolvedAddrs is an option that makes Resolve, ResolveAll and the other methods built on
+// them fail with an error wrapping ErrInsufficientAddrs when a multiaddr resolves to fewer than k
+// addresses in the end. Intermediate results, like the single record of a /dnsaddr that ResolveAll
+// expands further, aren't held to it. The addresses that did resolve are returned along with the
+// error. Defaults to 0, accepting any number.
+func WithMinResolvedAddrs(k int) Option {
+	return func(r *Resolver) error {
+		r.minAddrs = k
+		return nil
+	}
+}
+
+// WithMaxConcurrency is an option that bounds the number of addresses ResolveAll resolves
+// concurrently, such as the hosts that a /dnsaddr record delegates to. Defaults to 8.
+func WithMaxConcurrency(n int) Option {
+	return func(r *Resolver) error {
+		if n < 1 {
+			return fmt.Errorf("invalid max concurrency %d", n)
+		}
+		r.maxConcurrency = n
+		return nil
+	}
+}
+
+// WithMaxCrossProduct is an option that bounds the number of partially resolved addresses
+// ResolveAll carries from one round of resolution to the next. Addresses like
+// /dns/a/dns/b/dns/c multiply with every round, and this keeps their growth in check before the
+// final cap on resolved addresses applies. Addresses past the limit are dropped in order.
+// Defaults to 100.
+func WithMaxCrossProduct(n int) Option {
+	return func(r *Resolver) error {
+		if n < 1 {
+			return fmt.Errorf("invalid max cross product %d", n)
+		}
+		r.maxCrossProduct = n
+		return nil
+	}
+}
+
+// WithMaxDNSHops is an option that bounds the number of resolvable components in a multiaddr.
+// Every component triggers lookups, and the addresses they resolve to multiply, so multiaddrs
+// with more than n of them are rejected with ErrTooManyHops before any lookup is made. ResolveAll
+// applies the limit to every address it resolves, including the ones dnsaddr records point to.
+// Defaults to 16.
+func WithMaxDNSHops(n int) Option {
+	return func(r *Resolver) error {
+		if n < 1 {
+			return fmt.Errorf("invalid max dns hops %d", n)
+		}
+		r.maxDNSHops = n
+		return nil
+	}
+}
+
+func (r *Resolver) dnsHopsLimit() int {
+	if r.maxDNSHops == 0 {
+		return defaultMaxDNSHops
+	}
+	return r.maxDNSHops
+}
+
+// checkDNSHops returns ErrTooManyHops if a multiaddr with the given number of resolvable
+// components has too many of them.
+func (r *Resolver) checkDNSHops(hops int) error {
+	if limit := r.dnsHopsLimit(); hops > limit {
+		return fmt.Errorf("%w: %d, limit is %d", ErrTooManyHops, hops, limit)
+	}
+	return nil
+}
+
+func (r *Resolver) crossProductLimit() int {
+	if r.maxCrossProduct == 0 {
+		return maxResolvedAddrs
+	}
+	return r.maxCrossProduct
+}
+
+func (r *Resolver) concurrency() int {
+	if r.maxConcurrency == 0 {
+		return defaultMaxConcurrency
+	}
+	return r.maxConcurrency
+}
+
+// WithStripPeerIDs is an option that removes the trailing /p2p component from addresses resolved
+// from /dnsaddr records. This is useful when the peer ID is already known from context.
+func WithStripPeerIDs() Option {
+	return func(r *Resolver) error {
+		r.stripPeerIDs = true
+		return nil
+	}
+}
+
+// WithPreferPeerIDRecords is an option that sorts addresses resolved from /dnsaddr records
+// ending with a /p2p component ahead of those without one, which can't be authenticated. In
+// strict mode, addresses without a /p2p component are dropped instead. WithReachabilityProbe and
+// WithScorer sort after this one, and so take precedence over it.
+func WithPreferPeerIDRecords(strict bool) Option {
+	return func(r *Resolver) error {
+		r.preferPeerIDs = true
+		r.preferPeerIDsStrict = strict
+		return nil
+	}
+}
+
+// WithRetryOnEmpty is an option that retries the TXT lookup of a /dnsaddr component up to
+// attempts more times, waiting delay before each retry, as long as it comes back empty. This
+// helps with eventually consistent zones that may answer with no records at first. Errors are
+// not retried.
+func WithRetryOnEmpty(attempts int, delay time.Duration) Option {
+	return func(r *Resolver) error {
+		if attempts < 0 || delay < 0 {
+			return fmt.Errorf("invalid retry on empty configuration: %d attempts, delay %s", attempts, delay)
+		}
+		r.emptyRetries = attempts
+		r.emptyRetryDelay = delay
+		return nil
+	}
+}
+
+// queryDnsaddrTXT looks up the dnsaddr records on name, retrying while there are none if
+// configured to.
+func (r *Resolver) queryDnsaddrTXT(ctx context.Context, rslv BasicResolver, name string) ([]string, error) {
+	records, err := r.queryTXT(ctx, rslv, name)
+	for i := 0; i < r.emptyRetries && err == nil && len(records) == 0; i++ {
+		t := time.NewTimer(r.emptyRetryDelay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+		records, err = r.queryTXT(ctx, rslv, name)
+	}
+	return records, err
+}
+
+// WithDnsaddrQueryApex is an option that makes /dnsaddr resolution also look for dnsaddr
+// records on the bare domain, in addition to the _dnsaddr. subdomain mandated by the spec, and
+// merge the results. This helps with zones that publish their records in the wrong place.
+func WithDnsaddrQueryApex(enable bool) Option {
+	return func(r *Resolver) error {
+		r.dnsaddrQueryApex = enable
+		return nil
+	}
+}
+
+// WithDnsaddrUnmapIPv4 is an option that rewrites IPv4-mapped /ip6 components (e.g.
+// /ip6/::ffff:192.0.2.1) in addresses resolved from /dnsaddr records into the equivalent /ip4
+// component, so that they are treated like any other IPv4 address. By default, records are
+// returned as published.
+func WithDnsaddrUnmapIPv4(enable bool) Option {
+	return func(r *Resolver) error {
+		r.dnsaddrUnmapIPv4 = enable
+		return nil
+	}
+}
+
+// WithErrorOnEmpty is an option that controls whether resolving a component to no address is
+// an error. When set, Resolve fails with ErrNoResolvableAddrs instead of returning no addresses,
+// whether there were no records at all or all of them were filtered out. ResolveWithMeta tells
+// the two cases apart either way.
+func WithErrorOnEmpty(errorOnEmpty bool) Option {
+	return func(r *Resolver) error {
+		r.errorOnEmpty = errorOnEmpty
+		return nil
+	}
+}
+
+// TXTRecordValidator decides whether a dnsaddr TXT record may be used, given the raw record and
+// the multiaddr parsed from it.
+type TXTRecordValidator func(raw string, parsed ma.Multiaddr) bool
+
+// WithTXTRecordValidator is an option that checks every dnsaddr record with validate, after it
+// has been parsed and before it is matched against the multiaddr being resolved. Records that
+// fail validation are dropped, and reported by ResolveWithMeta with ErrRecordRejected.
+func WithTXTRecordValidator(validate TXTRecordValidator) Option {
+	return func(r *Resolver) error {
+		r.txtValidator = validate
+		return nil
+	}
+}
+
+// WithLenientPortSuffix is an option that accepts /dns, /dns4 and /dns6 components with a port
+// appended to the domain, as in /dns4/example.com:4001, and resolves them as if written
+// /dns4/example.com/tcp/4001. By default, such components fail with ErrPortInDomain.
+func WithLenientPortSuffix() Option {
+	return func(r *Resolver) error {
+		r.lenientPortSuffix = true
+		return nil
+	}
+}
+
+// WithPreserveDomainCase is an option that returns the domains of dns components within
+// /dnsaddr records as published. By default, they are lowercased, as DNS is case-insensitive
+// and mixed casing would otherwise produce duplicate addresses.
+func WithPreserveDomainCase() Option {
+	return func(r *Resolver) error {
+		r.preserveDomainCase = true
+		return nil
+	}
+}
+
+// WithDnsaddrTransportFilter is an option that only keeps /dnsaddr records using at least one
+// of the given transport protocols, such as "tcp", "quic-v1" or "webtransport", regardless of
+// their ports.
+func WithDnsaddrTransportFilter(transports []string) Option {
+	return func(r *Resolver) error {
+		for _, name := range transports {
+			p := ma.ProtocolWithName(name)
+			if p.Code == 0 {
+				return fmt.Errorf("unknown transport protocol %q", name)
+			}
+			r.dnsaddrTransports = append(r.dnsaddrTransports, p.Code)
+		}
+		return nil
+	}
+}
+
+// WithDefaultPort is an option that completes /dnsaddr records made of a bare address, like
+// /ip4/192.0.2.1 or /dns4/example.com/p2p/Qm..., with a /tcp or /udp component carrying the
+// given port, so that they can be dialed as is. Records that already have a /tcp or /udp
+// component are left unchanged.
+func WithDefaultPort(proto string, port int) Option {
+	return func(r *Resolver) error {
+		if proto != "tcp" && proto != "udp" {
+			return fmt.Errorf("default port protocol must be tcp or udp, not %q", proto)
+		}
+		c, err := ma.NewComponent(proto, strconv.Itoa(port))
+		if err != nil {
+			return err
+		}
+		r.defaultPort = c
+		return nil
+	}
+}
+
+// WithTreatErrorsAsNXDOMAIN is an option that reports the backend errors matched by match as if
+// the name didn't exist, that is as a *net.DNSError with IsNotFound set and the message of the
+// original error. It's meant for names whose authoritative servers fail instead of answering
+// NXDOMAIN. By default, errors are reported as is.
+func WithTreatErrorsAsNXDOMAIN(match func(error) bool) Option {
+	return func(r *Resolver) error {
+		r.notFoundMatcher = match
+		return nil
+	}
+}
+
+// asNotFound replaces err with a not found error for name if it's matched by notFoundMatcher.
+func (r *Resolver) asNotFound(name string, err error) error {
+	if err == nil || r.notFoundMatcher == nil || isNotFound(err) || !r.notFoundMatcher(err) {
+		return err
+	}
+	return &net.DNSError{Err: err.Error(), Name: name, IsNotFound: true}
+}
+
+// getResolver returns the resolver responsible for domain, or backend if it isn't nil.
+func (r *Resolver) getResolver(backend BasicResolver, domain string) BasicResolver {
+	if backend != nil {
+		return backend
+	}
+	if rslv, ok := r.getCustomResolver(domain); ok {
+		return rslv
+	}
+	return r.def
+}
+
+func (r *Resolver) getCustomResolver(domain string) (BasicResolver, bool) {
 	fqdn := dns.Fqdn(domain)
 
 	// we match left-to-right, with more specific resolvers superseding generic ones.
@@ -89,7 +512,7 @@ func (r *Resolver) getResolver(domain string) BasicResolver {
 	// there is no match
 	rslv, ok := r.custom[fqdn]
 	if ok {
-		return rslv
+		return rslv, true
 	}
 
 	for i := strings.Index(fqdn, "."); i != -1; i = strings.Index(fqdn, ".") {
@@ -101,28 +524,50 @@ func (r *Resolver) getResolver(domain string) BasicResolver {
 
 		rslv, ok = r.custom[fqdn]
 		if ok {
-			return rslv
+			return rslv, true
 		}
 	}
 
-	return r.def
+	return nil, false
 }
 
 // Resolve resolves a DNS multiaddr. It will only resolve the first DNS component in the multiaddr.
 // If you need to resolve multiple DNS components, you may call this function again with each returned address.
+//
+// Resolved addresses are returned in the order the backend returned the records they came from,
+// so the result is deterministic for a given set of answers, and duplicates are dropped. Options
+// that reorder results, like WithReachabilityProbe, WithScorer and WithResultPipeline, do so
+// with stable sorts.
 func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multiaddr, error) {
+	addrs, err := r.resolveFirst(ctx, maddr, nil, nil)
+	return addrs, r.checkResult(hasResolvable(maddr), len(addrs), err)
+}
+
+// ResolveWith is like Resolve, but looks up every name with backend instead of the configured
+// resolvers, whether default, per-domain or per-family. The rest of the configuration, such as
+// static overrides and filters, still applies. It allows trying out a backend on specific
+// addresses.
+func (r *Resolver) ResolveWith(ctx context.Context, maddr ma.Multiaddr, backend BasicResolver) ([]ma.Multiaddr, error) {
+	if backend == nil {
+		return nil, errors.New("nil backend")
+	}
+	addrs, err := r.resolveFirst(ctx, maddr, backend, nil)
+	return addrs, r.checkResult(hasResolvable(maddr), len(addrs), err)
+}
+
+// resolveFirst implements Resolve, looking up names with backend instead of the configured
+// resolvers if it isn't nil, and collecting details about the resolution in meta if it isn't nil.
+func (r *Resolver) resolveFirst(ctx context.Context, maddr ma.Multiaddr, backend BasicResolver, meta *ResolveMeta) ([]ma.Multiaddr, error) {
 	if maddr == nil {
 		return nil, nil
 	}
+	if err := r.checkDNSHops(countResolvable(maddr)); err != nil {
+		return nil, err
+	}
 
 	// Find the next dns component.
 	preDNS, maddr := ma.SplitFunc(maddr, func(c ma.Component) bool {
-		switch c.Protocol().Code {
-		case dnsProtocol.Code, dns4Protocol.Code, dns6Protocol.Code, dnsaddrProtocol.Code:
-			return true
-		default:
-			return false
-		}
+		return isResolvable(c.Protocol().Code)
 	})
 
 	// If the rest is empty, we've hit the end (there _was_ no dns component).
@@ -133,12 +578,211 @@ func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multia
 	// split off the dns component.
 	resolve, postDNS := ma.SplitFirst(maddr)
 
-	proto := resolve.Protocol()
-	value := resolve.Value()
-	rslv := r.getResolver(value)
+	return r.resolve(ctx, preDNS, resolve, postDNS, backend, meta)
+}
+
+// ResolveComponents is like Resolve, but operates on a multiaddr that has already been split into
+// its components.
+func (r *Resolver) ResolveComponents(ctx context.Context, comps []ma.Component) ([]ma.Multiaddr, error) {
+	if len(comps) == 0 {
+		return nil, nil
+	}
+	hops := 0
+	for _, c := range comps {
+		if isResolvable(c.Protocol().Code) {
+			hops++
+		}
+	}
+	if err := r.checkDNSHops(hops); err != nil {
+		return nil, err
+	}
+
+	// Find the next dns component.
+	i := slices.IndexFunc(comps, func(c ma.Component) bool {
+		return isResolvable(c.Protocol().Code)
+	})
+	if i < 0 {
+		return []ma.Multiaddr{joinComponents(comps)}, nil
+	}
+
+	addrs, err := r.resolve(ctx, joinComponents(comps[:i]), &comps[i], joinComponents(comps[i+1:]), nil, nil)
+	return addrs, r.checkResult(true, len(addrs), err)
+}
+
+// resolve resolves the dns component c and wraps the results in the parts of the multiaddr
+// before and after it. Names are looked up with backend if it isn't nil, and details about the
+// resolution are collected in meta if it isn't nil.
+func (r *Resolver) resolve(ctx context.Context, preDNS ma.Multiaddr, c *ma.Component, postDNS ma.Multiaddr, backend BasicResolver, meta *ResolveMeta) ([]ma.Multiaddr, error) {
+	proto := c.Protocol()
+	if host, port, ok := splitPortSuffix(c.Value()); ok && isDNSProtocol(proto.Code) {
+		if proto.Code == dnsaddrProtocol.Code {
+			// the records set the ports, there is no other form to suggest.
+			return nil, fmt.Errorf("%w: the port doesn't belong in /%s/%s",
+				ErrPortInDomain, proto.Name, c.Value())
+		}
+		if !r.lenientPortSuffix {
+			return nil, fmt.Errorf("%w: use /%s/%s/tcp/%s instead of /%s/%s",
+				ErrPortInDomain, proto.Name, host, port, proto.Name, c.Value())
+		}
+		// rewrite /dns4/host:port to /dns4/host/tcp/port.
+		hc, err := ma.NewComponent(proto.Name, host)
+		if err != nil {
+			return nil, err
+		}
+		tcp, err := ma.NewComponent("tcp", port)
+		if err != nil {
+			return nil, err
+		}
+		if postDNS != nil {
+			return r.resolve(ctx, preDNS, hc, tcp.Encapsulate(postDNS), backend, meta)
+		}
+		return r.resolve(ctx, preDNS, hc, tcp, backend, meta)
+	}
+
+	resolved, found, err := r.resolveComponent(ctx, c, postDNS, backend, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved = dropInRanges(resolved, r.dropRanges)
+
+	if r.rebindingProtection && isDNSProtocol(proto.Code) && !isLocalName(c.Value()) {
+		n := len(resolved)
+		resolved = dropInRanges(resolved, PrivateRanges)
+		if r.rebindingStrict && len(resolved) != n {
+			return nil, fmt.Errorf("%w: %s resolves to a private address", ErrRebinding, c.Value())
+		}
+	}
+
+	if len(resolved) == 0 {
+		return nil, r.emptyResult(c, found, meta)
+	}
+
+	// Records may repeat, or only differ in ways we normalized away.
+	resolved, _ = Dedup(ctx, resolved)
+
+	if len(resolved) > maxResolvedAddrs {
+		resolved = resolved[:maxResolvedAddrs]
+	}
+
+	if preDNS != nil {
+		for i, m := range resolved {
+			resolved[i] = preDNS.Encapsulate(m)
+		}
+	}
+	if postDNS != nil {
+		for i, m := range resolved {
+			resolved[i] = m.Encapsulate(postDNS)
+		}
+	}
+
+	if r.preferPeerIDs && proto.Code == dnsaddrProtocol.Code {
+		resolved = r.sortByPeerID(resolved)
+	}
+
+	if r.stripPeerIDs && proto.Code == dnsaddrProtocol.Code {
+		stripped := resolved[:0]
+		for _, m := range resolved {
+			if m = StripPeerID(m); m != nil {
+				stripped = append(stripped, m)
+			}
+		}
+		// addresses of different peers may be the same once stripped.
+		resolved, _ = Dedup(ctx, stripped)
+	}
+
+	if r.probe != nil {
+		resolved = r.sortByReachability(ctx, resolved)
+	}
+	if r.scorer != nil {
+		resolved = r.sortByScore(resolved)
+	}
+
+	resolved, err = r.runPipeline(ctx, resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resolved) == 0 {
+		return nil, r.emptyResult(c, true, meta)
+	}
+	return resolved, nil
+}
+
+// emptyResult records why the component c resolved to no addresses in meta, and returns the
+// error to report for it, if any.
+func (r *Resolver) emptyResult(c *ma.Component, found bool, meta *ResolveMeta) error {
+	if found {
+		meta.setOutcome(OutcomeFiltered)
+	} else {
+		meta.setOutcome(OutcomeNoRecords)
+	}
+	if r.errorOnEmpty {
+		if found {
+			return fmt.Errorf("%w: all records for %s were filtered out", ErrNoResolvableAddrs, c.Value())
+		}
+		return fmt.Errorf("%w: no records for %s", ErrNoResolvableAddrs, c.Value())
+	}
+	return nil
+}
+
+// sortByPeerID moves the addresses with a trailing /p2p component ahead of the others, dropping
+// the others in strict mode.
+func (r *Resolver) sortByPeerID(addrs []ma.Multiaddr) []ma.Multiaddr {
+	withID := make([]ma.Multiaddr, 0, len(addrs))
+	var withoutID []ma.Multiaddr
+	for _, addr := range addrs {
+		if _, p2p := splitPeerID(addr); p2p != nil {
+			withID = append(withID, addr)
+		} else {
+			withoutID = append(withoutID, addr)
+		}
+	}
+	if r.preferPeerIDsStrict {
+		return withID
+	}
+	return append(withID, withoutID...)
+}
+
+// checkResult returns the error to report for the final result of a resolution that found n
+// addresses and failed with err, if any. Multiaddrs without anything to resolve aren't held to
+// the minimum set with WithMinResolvedAddrs.
+func (r *Resolver) checkResult(resolvable bool, n int, err error) error {
+	if err != nil {
+		return err
+	}
+	if resolvable && n < r.minAddrs {
+		return fmt.Errorf("%w: resolved %d, want at least %d", ErrInsufficientAddrs, n, r.minAddrs)
+	}
+	return nil
+}
+
+// hasResolvable is like Matches, but also accepts a nil multiaddr.
+func hasResolvable(maddr ma.Multiaddr) bool {
+	return maddr != nil && Matches(maddr)
+}
+
+// resolveComponent resolves a single resolvable component into the addresses it stands for.
+// postDNS is the part of the multiaddr following the component, which /dnsaddr records are
+// matched against and stripped of. The /dnsaddr records that are skipped are reported in meta
+// if it isn't nil. found reports whether there were any records for the component at all, even
+// if none of them could be used.
+func (r *Resolver) resolveComponent(ctx context.Context, c *ma.Component, postDNS ma.Multiaddr, backend BasicResolver, meta *ResolveMeta) (resolved []ma.Multiaddr, found bool, err error) {
+	proto := c.Protocol()
+	value := c.Value()
+
+	// Static /dnsaddr overrides stand in for the TXT records, and are matched against postDNS
+	// like them below.
+	static, isStatic := r.static[staticKey(value)]
+	if isStatic && isDNSProtocol(proto.Code) {
+		r.stats.staticHits.Add(1)
+		if proto.Code != dnsaddrProtocol.Code {
+			return slices.Clone(static), len(static) > 0, nil
+		}
+	}
+
+	rslv := r.getResolver(backend, value)
 
-	// resolve the dns component
-	var resolved []ma.Multiaddr
 	switch proto.Code {
 	case dns4Protocol.Code, dns6Protocol.Code, dnsProtocol.Code:
 		// The dns, dns4, and dns6 resolver simply resolves each
@@ -151,9 +795,17 @@ func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multia
 		// differentiating between IPv6 and IPv4. A v4-in-v6
 		// AAAA record will _look_ like an A record to us and
 		// there's nothing we can do about that.
-		records, err := rslv.LookupIPAddr(ctx, value)
+		// With DNS64, we need both families to tell whether to synthesize.
+		dns64 := r.dns64 != nil
+		records, err := r.lookupIPAddr(ctx, backend, value, !v6only || dns64, !v4only || dns64)
 		if err != nil {
-			return nil, err
+			return nil, false, err
+		}
+		if dns64 {
+			if synthesized, ok := r.synthesizeDNS64(records); ok {
+				// dns4 resolves to the synthesized IPv6 addresses too.
+				records, v4only = synthesized, false
+			}
 		}
 
 		// Convert each DNS record into a multiaddr. If the
@@ -178,7 +830,7 @@ func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multia
 				rmaddr, err = ma.NewMultiaddr("/ip4/" + ip4.String())
 			}
 			if err != nil {
-				return nil, err
+				return nil, false, err
 			}
 			resolved = append(resolved, rmaddr)
 		}
@@ -192,9 +844,30 @@ func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multia
 		//    matching the result of step 2.
 
 		// First, lookup the TXT record
-		records, err := rslv.LookupTXT(ctx, "_dnsaddr."+value)
-		if err != nil {
-			return nil, err
+		var records []string
+		if isStatic {
+			for _, addr := range static {
+				records = append(records, dnsaddrTXTPrefix+addr.String())
+			}
+		} else {
+			records, err = r.queryDnsaddrTXT(ctx, rslv, "_dnsaddr."+value)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		found = len(records) > 0
+		// Records past this point come from the apex, and aren't expected to
+		// all be dnsaddr records.
+		nDnsaddr := len(records)
+		if r.dnsaddrQueryApex && !isStatic {
+			// Best effort, the records on _dnsaddr. are the ones the spec
+			// asks for.
+			if apex, err := r.queryTXT(ctx, rslv, value); err == nil {
+				records = append(records, apex...)
+				found = found || slices.ContainsFunc(apex, func(txt string) bool {
+					return strings.HasPrefix(txt, dnsaddrTXTPrefix)
+				})
+			}
 		}
 
 		// Then, calculate the length of the suffix we're
@@ -204,21 +877,61 @@ func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multia
 			length = addrLen(postDNS)
 		}
 
-		for _, r := range records {
+		budget := r.maxTXTBytes
+		for i, txt := range records {
+			// Stop once we've gone through as much as we're willing to,
+			// reporting what we leave out.
+			if r.maxTXTBytes > 0 {
+				budget -= len(txt)
+				if budget < 0 {
+					for j := i; j < len(records); j++ {
+						if j < nDnsaddr || strings.HasPrefix(records[j], dnsaddrTXTPrefix) {
+							meta.addRecordError(recordName(value, j, nDnsaddr), records[j], ErrTXTBudgetExceeded)
+						}
+					}
+					break
+				}
+			}
+
 			// Ignore non dnsaddr TXT records.
-			if !strings.HasPrefix(r, dnsaddrTXTPrefix) {
+			if !strings.HasPrefix(txt, dnsaddrTXTPrefix) {
+				if i < nDnsaddr {
+					meta.addRecordError(recordName(value, i, nDnsaddr), txt, ErrNotDnsaddrRecord)
+				}
+				continue
+			}
+
+			// Don't bother parsing absurdly long records.
+			if len(txt) > r.txtRecordLimit() {
+				meta.addRecordError(recordName(value, i, nDnsaddr), txt, ErrRecordTooLong)
 				continue
 			}
 
 			// Extract and decode the multiaddr.
-			rmaddr, err := ma.NewMultiaddr(r[len(dnsaddrTXTPrefix):])
+			rmaddr, err := ma.NewMultiaddr(txt[len(dnsaddrTXTPrefix):])
 			if err != nil {
 				// discard multiaddrs we don't understand.
 				// XXX: Is this right? It's the best we
 				// can do for now, really.
+				meta.addRecordError(recordName(value, i, nDnsaddr), txt, err)
+				continue
+			}
+
+			// Skip records over transports we don't want.
+			if len(r.dnsaddrTransports) > 0 && !hasProtocol(rmaddr, r.dnsaddrTransports) {
+				meta.addRecordError(recordName(value, i, nDnsaddr), txt, ErrRecordTransportFiltered)
 				continue
 			}
 
+			if r.txtValidator != nil && !r.txtValidator(txt, rmaddr) {
+				meta.addRecordError(recordName(value, i, nDnsaddr), txt, ErrRecordRejected)
+				continue
+			}
+
+			if r.defaultPort != nil {
+				rmaddr = withDefaultPort(rmaddr, r.defaultPort)
+			}
+
 			// If we have a suffix to match on.
 			if postDNS != nil {
 				// Make sure the new address is at least
@@ -227,6 +940,7 @@ func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multia
 				rmlen := addrLen(rmaddr)
 				if rmlen < length {
 					// not long enough.
+					meta.addRecordError(recordName(value, i, nDnsaddr), txt, ErrRecordSuffixMismatch)
 					continue
 				}
 
@@ -237,7 +951,11 @@ func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multia
 				// /ip4/1.2.3.4/tcp/1234/p2p/QmFoobar
 				//                      /p2p/QmFoobar
 				// ^--(rmlen - length)--^---length--^
+				//
+				// Both sides are compared in their binary form, so records
+				// that spell a value differently (e.g. /tcp/0123) still match.
 				if !postDNS.Equal(offset(rmaddr, rmlen-length)) {
+					meta.addRecordError(recordName(value, i, nDnsaddr), txt, ErrRecordSuffixMismatch)
 					continue
 				}
 			}
@@ -249,38 +967,282 @@ func (r *Resolver) Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multia
 			if rmaddr == nil {
 				continue
 			}
+			if r.dnsaddrUnmapIPv4 {
+				rmaddr = unmapIPv4(rmaddr)
+			}
+			if !r.preserveDomainCase {
+				rmaddr = lowercaseDomains(rmaddr)
+			}
+			meta.addRecord(txt)
 			resolved = append(resolved, rmaddr)
 		}
 	default:
-		panic("unreachable")
+		// A custom protocol registered with RegisterResolvable.
+		handler, ok := getHandler(proto.Code)
+		if !ok {
+			panic("unreachable")
+		}
+		addrs, err := handler(ctx, value)
+		if err != nil {
+			return nil, false, err
+		}
+		// the handler may hand us a slice it holds on to.
+		resolved = slices.Clone(addrs)
 	}
 
-	if len(resolved) == 0 {
+	if proto.Code != dnsaddrProtocol.Code {
+		found = len(resolved) > 0
+	}
+	return resolved, found, nil
+}
+
+// ResolveAll fully resolves a multiaddr by calling Resolve repeatedly until none of the
+// returned addresses contain a resolvable component. Only fully resolved addresses are
+// returned, capped at the same limit as Resolve, and each of them only once. Addresses that
+// resolve back to an address already seen are dropped, and resolution fails if it takes more than
+// a bounded number of rounds.
+//
+// Each name is looked up at most once per backend during a call, so the dns4 and dns6
+// components of /dns4/example.com/tcp/1/dns6/example.com/tcp/2 share a single lookup.
+func (r *Resolver) ResolveAll(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multiaddr, error) {
+	addrs, err := r.resolveAll(ctx, maddr)
+	return addrs, r.checkResult(hasResolvable(maddr), len(addrs), err)
+}
+
+// resolveAll implements ResolveAll, without enforcing WithMinResolvedAddrs on the result.
+func (r *Resolver) resolveAll(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multiaddr, error) {
+	if maddr == nil {
 		return nil, nil
 	}
+	if !Matches(maddr) {
+		return []ma.Multiaddr{maddr}, nil
+	}
 
-	if len(resolved) > maxResolvedAddrs {
-		resolved = resolved[:maxResolvedAddrs]
+	// Names are often repeated across components and rounds, only look
+	// them up once.
+	ctx = withLookupMemo(ctx)
+
+	var resolved []ma.Multiaddr
+	seen := map[string]struct{}{string(maddr.Bytes()): {}}
+	toResolve := []ma.Multiaddr{maddr}
+	for depth := 0; len(toResolve) > 0; depth++ {
+		if depth >= maxResolveDepth {
+			return nil, fmt.Errorf("resolving %s took more than %d rounds", maddr, maxResolveDepth)
+		}
+
+		// Resolve the whole round concurrently, but go through the
+		// results in order to keep the output deterministic.
+		results := make([][]ma.Multiaddr, len(toResolve))
+		err := forEachLimit(ctx, len(toResolve), r.concurrency(), func(ctx context.Context, i int) error {
+			var err error
+			results[i], err = r.resolveFirst(ctx, toResolve[i], nil, nil)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var next []ma.Multiaddr
+		for _, addrs := range results {
+			for _, addr := range addrs {
+				// don't go around in circles, nor return the same
+				// address reached through different paths twice.
+				key := string(addr.Bytes())
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+				if !Matches(addr) {
+					resolved = append(resolved, addr)
+					continue
+				}
+				next = append(next, addr)
+			}
+			if len(resolved) >= maxResolvedAddrs {
+				return resolved[:maxResolvedAddrs], nil
+			}
+		}
+		// Every round multiplies the addresses still to be resolved, so
+		// cap them before the next one.
+		if limit := r.crossProductLimit(); len(next) > limit {
+			next = next[:limit]
+		}
+		toResolve = next
 	}
+	return resolved, nil
+}
 
-	if preDNS != nil {
-		for i, m := range resolved {
-			resolved[i] = preDNS.Encapsulate(m)
+// Validate checks that a multiaddr fully resolves to at least one address, without returning the
+// addresses. It returns ErrNoResolvableAddrs if resolution succeeds but yields no addresses, and
+// the resolution error if it fails.
+func (r *Resolver) Validate(ctx context.Context, maddr ma.Multiaddr) error {
+	addrs, err := r.ResolveAll(ctx, maddr)
+	if err != nil {
+		return err
+	}
+	if len(addrs) == 0 {
+		return ErrNoResolvableAddrs
+	}
+	return nil
+}
+
+// ResolveWithPeerIDs resolves a DNS multiaddr like Resolve, but groups the resolved addresses by
+// their trailing /p2p component. The map is keyed by the peer ID string and the grouped
+// addresses have the /p2p component removed. Addresses without a trailing /p2p component are
+// grouped under the empty string.
+func (r *Resolver) ResolveWithPeerIDs(ctx context.Context, maddr ma.Multiaddr) (map[string][]ma.Multiaddr, error) {
+	resolved, err := r.Resolve(ctx, maddr)
+	if err != nil {
+		return nil, err
+	}
+
+	byPeer := make(map[string][]ma.Multiaddr)
+	for _, addr := range resolved {
+		addr, p2p := splitPeerID(addr)
+		var id string
+		if p2p != nil {
+			id = p2p.Value()
 		}
+		if addr == nil {
+			// a bare /p2p address, there is nothing to dial.
+			continue
+		}
+		byPeer[id] = append(byPeer[id], addr)
 	}
-	if postDNS != nil {
-		for i, m := range resolved {
-			resolved[i] = m.Encapsulate(postDNS)
+	return byPeer, nil
+}
+
+// ResolvePeerAddrs fully resolves a set of multiaddrs that may advertise the same peers through
+// different hosts, like /dnsaddr/a.com/p2p/Qm... and /dnsaddr/b.com/p2p/Qm.... The resolved
+// addresses are deduplicated and grouped by their trailing /p2p component, with peers in the
+// order they were first seen. It fails if any of the multiaddrs fails to resolve.
+func (r *Resolver) ResolvePeerAddrs(ctx context.Context, maddrs []ma.Multiaddr) ([]ma.Multiaddr, error) {
+	results := make([][]ma.Multiaddr, len(maddrs))
+	err := forEachLimit(ctx, len(maddrs), r.concurrency(), func(ctx context.Context, i int) error {
+		var err error
+		results[i], err = r.resolveAll(ctx, maddrs[i])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		peers  []string
+		byPeer = make(map[string][]ma.Multiaddr)
+		seen   = make(map[string]struct{})
+	)
+	for _, addrs := range results {
+		for _, addr := range addrs {
+			key := string(addr.Bytes())
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			var id string
+			if _, p2p := splitPeerID(addr); p2p != nil {
+				id = p2p.Value()
+			}
+			if _, ok := byPeer[id]; !ok {
+				peers = append(peers, id)
+			}
+			byPeer[id] = append(byPeer[id], addr)
 		}
 	}
 
-	return resolved, nil
+	var resolved []ma.Multiaddr
+	for _, id := range peers {
+		resolved = append(resolved, byPeer[id]...)
+	}
+	return resolved, r.checkResult(slices.ContainsFunc(maddrs, hasResolvable), len(resolved), nil)
 }
 
+// ResolveNetAddrs fully resolves a multiaddr like ResolveAll, and converts the resolved addresses
+// of the form /ip4|ip6/tcp|udp/port, optionally followed by a /p2p component, into *net.TCPAddr
+// and *net.UDPAddr. Addresses that can't be represented as either, such as QUIC or circuit
+// addresses, are skipped.
+func (r *Resolver) ResolveNetAddrs(ctx context.Context, maddr ma.Multiaddr) ([]net.Addr, error) {
+	resolved, err := r.resolveAll(ctx, maddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []net.Addr
+	for _, m := range resolved {
+		m, _ = splitPeerID(m)
+		if m == nil {
+			continue
+		}
+		addr, err := manet.ToNetAddr(m)
+		if err != nil {
+			continue
+		}
+		switch addr.(type) {
+		case *net.TCPAddr, *net.UDPAddr:
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, r.checkResult(hasResolvable(maddr), len(addrs), nil)
+}
+
+// LookupIPAddr looks up the IP addresses of domain with the resolver responsible for it. IP
+// literals are returned as is, without querying any resolver.
 func (r *Resolver) LookupIPAddr(ctx context.Context, domain string) ([]net.IPAddr, error) {
-	return r.getResolver(domain).LookupIPAddr(ctx, domain)
+	return r.lookupIPAddr(ctx, nil, domain, true, true)
+}
+
+// lookupIPAddr looks up the IPv4 and/or IPv6 addresses of domain, querying backend if it isn't
+// nil, and otherwise the per-family resolvers if there are any and no custom resolver is
+// responsible for the domain. Addresses of families that weren't asked for may still be returned.
+func (r *Resolver) lookupIPAddr(ctx context.Context, backend BasicResolver, domain string, v4, v6 bool) ([]net.IPAddr, error) {
+	if ip := net.ParseIP(domain); ip != nil {
+		return []net.IPAddr{{IP: ip}}, nil
+	}
+	if backend != nil {
+		return r.queryIPAddr(ctx, backend, domain)
+	}
+	if rslv, ok := r.getCustomResolver(domain); ok {
+		return r.queryIPAddr(ctx, rslv, domain)
+	}
+	if r.ipv4 == nil && r.ipv6 == nil {
+		return r.queryIPAddr(ctx, r.def, domain)
+	}
+
+	var records []net.IPAddr
+	if v4 {
+		rslv := r.def
+		if r.ipv4 != nil {
+			rslv = r.ipv4
+		}
+		res, err := r.queryIPAddr(ctx, rslv, domain)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range res {
+			if a.IP.To4() != nil {
+				records = append(records, a)
+			}
+		}
+	}
+	if v6 {
+		rslv := r.def
+		if r.ipv6 != nil {
+			rslv = r.ipv6
+		}
+		res, err := r.queryIPAddr(ctx, rslv, domain)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range res {
+			if a.IP.To4() == nil {
+				records = append(records, a)
+			}
+		}
+	}
+	return records, nil
 }
 
 func (r *Resolver) LookupTXT(ctx context.Context, txt string) ([]string, error) {
-	return r.getResolver(txt).LookupTXT(ctx, txt)
+	return r.queryTXT(ctx, r.getResolver(nil, txt), txt)
 }
@@ -2,9 +2,13 @@ package madns
 
 import (
 	"context"
+	"errors"
 	"net"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	ma "github.com/multiformats/go-multiaddr"
 )
@@ -123,38 +127,11 @@ func TestResolveOnlyOnce(t *testing.T) {
 	}
 }
 
-func resolveAllDNS(ctx context.Context, resolver *Resolver, in ma.Multiaddr) ([]ma.Multiaddr, error) {
-	if !Matches(in) {
-		return []ma.Multiaddr{in}, nil
-	}
-	var outAddrs []ma.Multiaddr
-	toResolve := []ma.Multiaddr{in}
-
-	for len(toResolve) > 0 {
-		var nextToResolve []ma.Multiaddr
-		for _, a := range toResolve {
-			addrs, err := resolver.Resolve(ctx, a)
-			if err != nil {
-				return nil, err
-			}
-			for _, addr := range addrs {
-				if Matches(addr) {
-					nextToResolve = append(nextToResolve, addr)
-				} else {
-					outAddrs = append(outAddrs, addr)
-				}
-			}
-		}
-		toResolve = nextToResolve
-	}
-	return outAddrs, nil
-}
-
 func TestResolveMultiple(t *testing.T) {
 	ctx := context.Background()
 	resolver := makeResolver()
 
-	addrs, err := resolveAllDNS(ctx, resolver, ma.StringCast("/dns4/example.com/quic/dns6/example.com"))
+	addrs, err := resolver.ResolveAll(ctx, ma.StringCast("/dns4/example.com/quic/dns6/example.com"))
 	if err != nil {
 		t.Error(err)
 	}
@@ -173,7 +150,7 @@ func TestResolveMultipleSandwitch(t *testing.T) {
 	ctx := context.Background()
 	resolver := makeResolver()
 
-	addrs, err := resolveAllDNS(ctx, resolver, ma.StringCast("/quic/dns4/example.com/dns6/example.com/http"))
+	addrs, err := resolver.ResolveAll(ctx, ma.StringCast("/quic/dns4/example.com/dns6/example.com/http"))
 	if err != nil {
 		t.Error(err)
 	}
@@ -387,3 +364,1836 @@ func TestLimitResolver(t *testing.T) {
 		t.Fatalf("expected %d, got %d", maxResolvedAddrs, len(addrs))
 	}
 }
+
+func TestResolveWithPeerIDs(t *testing.T) {
+	p2pa := ma.StringCast("/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx")
+	p2pb := ma.StringCast("/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN")
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.peers.com": {
+				"dnsaddr=" + ma.Join(ip4ma, p2pa).String(),
+				"dnsaddr=" + ma.Join(ip6ma, p2pa).String(),
+				"dnsaddr=" + ma.Join(ip4mb, p2pb).String(),
+				"dnsaddr=" + txtmd.String(),
+			},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	byPeer, err := resolver.ResolveWithPeerIDs(context.Background(), ma.StringCast("/dnsaddr/peers.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byPeer) != 3 {
+		t.Fatalf("expected 3 groups, got %+v", byPeer)
+	}
+
+	ida, _ := p2pa.ValueForProtocol(ma.P_P2P)
+	addrs := byPeer[ida]
+	if len(addrs) != 2 || !addrs[0].Equal(ip4ma) || !addrs[1].Equal(ip6ma) {
+		t.Fatalf("expected [%s %s], got %+v", ip4ma, ip6ma, addrs)
+	}
+
+	idb, _ := p2pb.ValueForProtocol(ma.P_P2P)
+	addrs = byPeer[idb]
+	if len(addrs) != 1 || !addrs[0].Equal(ip4mb) {
+		t.Fatalf("expected [%s], got %+v", ip4mb, addrs)
+	}
+
+	addrs = byPeer[""]
+	if len(addrs) != 1 || !addrs[0].Equal(txtmd) {
+		t.Fatalf("expected [%s], got %+v", txtmd, addrs)
+	}
+}
+
+var testNameProtocol = ma.Protocol{
+	Name:       "madns-test-name",
+	Code:       0x300001,
+	VCode:      ma.CodeToVarint(0x300001),
+	Size:       ma.LengthPrefixedVarSize,
+	Transcoder: ma.TranscoderDns,
+}
+
+func init() {
+	if err := ma.AddProtocol(testNameProtocol); err != nil {
+		panic(err)
+	}
+	err := RegisterResolvable(testNameProtocol, func(ctx context.Context, value string) ([]ma.Multiaddr, error) {
+		if value != "peer.test" {
+			return nil, nil
+		}
+		return []ma.Multiaddr{ip4ma, ip6ma}, nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestRegisterResolvable(t *testing.T) {
+	maddr := ma.StringCast("/madns-test-name/peer.test/tcp/1234")
+	if !Matches(maddr) {
+		t.Fatalf("expected match, didn't: %s", maddr)
+	}
+
+	addrs, err := makeResolver().Resolve(context.Background(), maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, x := range []ma.Multiaddr{ip4ma, ip6ma} {
+		expected := ma.Join(x, ma.StringCast("/tcp/1234"))
+		if i >= len(addrs) || !expected.Equal(addrs[i]) {
+			t.Fatalf("expected %s at %d, got %+v", expected, i, addrs)
+		}
+	}
+
+	handler := func(context.Context, string) ([]ma.Multiaddr, error) { return nil, nil }
+	if err := RegisterResolvable(testNameProtocol, handler); err == nil {
+		t.Fatal("expected registering a protocol twice to fail")
+	}
+	if err := RegisterResolvable(dnsaddrProtocol, handler); err == nil {
+		t.Fatal("expected overriding a built-in protocol to fail")
+	}
+	unregistered := ma.Protocol{Name: "madns-test-unregistered", Code: 0x300003}
+	if err := RegisterResolvable(unregistered, nil); err == nil {
+		t.Fatal("expected a nil handler to be rejected")
+	}
+	if isResolvable(unregistered.Code) {
+		t.Fatal("expected a rejected protocol not to be resolvable")
+	}
+}
+
+var testNamingProtocol = ma.Protocol{
+	Name:       "madns-test-naming",
+	Code:       0x300002,
+	VCode:      ma.CodeToVarint(0x300002),
+	Size:       ma.LengthPrefixedVarSize,
+	Transcoder: ma.TranscoderDns,
+}
+
+var testNamingHandler = &MockHandler{}
+
+func init() {
+	if err := ma.AddProtocol(testNamingProtocol); err != nil {
+		panic(err)
+	}
+	if err := RegisterResolvable(testNamingProtocol, testNamingHandler.Resolve); err != nil {
+		panic(err)
+	}
+}
+
+func TestCustomHandler(t *testing.T) {
+	var many []ma.Multiaddr
+	for i := 0; i < 255; i++ {
+		many = append(many, ma.StringCast("/ip4/1.2.3."+strconv.Itoa(i)))
+	}
+	testNamingHandler.Addrs = map[string][]ma.Multiaddr{
+		"node.example": {txtmd, ip6ma},
+		"many.example": many,
+	}
+
+	ctx := context.Background()
+	resolver := makeResolver()
+
+	addrs, err := resolver.Resolve(ctx, ma.StringCast("/quic/madns-test-naming/node.example/http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, x := range []ma.Multiaddr{txtmd, ip6ma} {
+		expected := ma.Join(ma.StringCast("/quic"), x, ma.StringCast("/http"))
+		if i >= len(addrs) || !expected.Equal(addrs[i]) {
+			t.Fatalf("expected %s at %d, got %+v", expected, i, addrs)
+		}
+	}
+
+	addrs, err = resolver.Resolve(ctx, ma.StringCast("/madns-test-naming/many.example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != maxResolvedAddrs {
+		t.Fatalf("expected %d, got %d", maxResolvedAddrs, len(addrs))
+	}
+
+	addrs, err = resolver.Resolve(ctx, ma.StringCast("/madns-test-naming/unknown.example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 0 {
+		t.Fatalf("expected [], got %+v", addrs)
+	}
+}
+
+func TestStripPeerID(t *testing.T) {
+	for _, tc := range []struct{ in, out string }{
+		{"/ip4/1.2.3.4/tcp/1/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx", "/ip4/1.2.3.4/tcp/1"},
+		{"/ip4/1.2.3.4/tcp/1", "/ip4/1.2.3.4/tcp/1"},
+		{
+			"/ip4/1.2.3.4/tcp/1/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx/p2p-circuit",
+			"/ip4/1.2.3.4/tcp/1/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx/p2p-circuit",
+		},
+		{
+			"/ip4/1.2.3.4/tcp/1/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx/p2p-circuit/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN",
+			"/ip4/1.2.3.4/tcp/1/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx/p2p-circuit",
+		},
+	} {
+		out := StripPeerID(ma.StringCast(tc.in))
+		if out == nil || out.String() != tc.out {
+			t.Fatalf("expected %s, got %s", tc.out, out)
+		}
+	}
+
+	if out := StripPeerID(ma.StringCast("/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx")); out != nil {
+		t.Fatalf("expected nil, got %s", out)
+	}
+}
+
+func TestResolveStripPeerIDs(t *testing.T) {
+	p2p := ma.StringCast("/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx")
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip4a},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=" + ma.Join(txtmd, p2p).String(),
+				"dnsaddr=" + ip6ma.String(),
+			},
+		},
+	}
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithStripPeerIDs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	addrs, err := resolver.Resolve(ctx, ma.StringCast("/dnsaddr/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || !addrs[0].Equal(txtmd) || !addrs[1].Equal(ip6ma) {
+		t.Fatalf("expected [%s %s], got %+v", txtmd, ip6ma, addrs)
+	}
+
+	addrs, err = resolver.Resolve(ctx, ma.Join(ma.StringCast("/dnsaddr/example.com"), p2p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(txtmd) {
+		t.Fatalf("expected [%s], got %+v", txtmd, addrs)
+	}
+
+	// Only /dnsaddr results are stripped.
+	addrs, err = resolver.Resolve(ctx, ma.Join(ma.StringCast("/dns4/example.com"), p2p))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := ma.Join(ip4ma, p2p); len(addrs) != 1 || !addrs[0].Equal(expected) {
+		t.Fatalf("expected [%s], got %+v", expected, addrs)
+	}
+}
+
+func TestResolveAllNonResolvable(t *testing.T) {
+	addrs, err := makeResolver().ResolveAll(context.Background(), ip4ma)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(ip4ma) {
+		t.Fatalf("expected [%s], got %+v", ip4ma, addrs)
+	}
+}
+
+func TestResolveAllLoop(t *testing.T) {
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.a.com": {"dnsaddr=/dnsaddr/b.com", txta},
+			"_dnsaddr.b.com": {"dnsaddr=/dnsaddr/a.com", txtb},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	addrs, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dnsaddr/a.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || !addrs[0].Equal(ip4ma) || !addrs[1].Equal(ip6ma) {
+		t.Fatalf("expected [%s %s], got %+v", ip4ma, ip6ma, addrs)
+	}
+}
+
+func TestResolveAllDepth(t *testing.T) {
+	mock := &MockResolver{TXT: map[string][]string{}}
+	for i := 0; i < maxResolveDepth; i++ {
+		mock.TXT["_dnsaddr."+strconv.Itoa(i)+".com"] = []string{"dnsaddr=/dnsaddr/" + strconv.Itoa(i+1) + ".com"}
+	}
+	resolver := &Resolver{def: mock}
+
+	_, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dnsaddr/0.com"))
+	if err == nil {
+		t.Fatal("expected resolution to fail after too many rounds")
+	}
+}
+
+func TestIPLiteral(t *testing.T) {
+	ctx := context.Background()
+	resolver := makeResolver()
+
+	addrs, err := resolver.Resolve(ctx, ma.StringCast("/dns4/1.2.3.4/tcp/1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := ma.StringCast("/ip4/1.2.3.4/tcp/1"); len(addrs) != 1 || !addrs[0].Equal(expected) {
+		t.Fatalf("expected [%s], got %+v", expected, addrs)
+	}
+
+	addrs, err = resolver.Resolve(ctx, ma.StringCast("/dns4/2001:db8::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 0 {
+		t.Fatalf("expected [], got %+v", addrs)
+	}
+
+	res, err := resolver.LookupIPAddr(ctx, "2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 1 || !res[0].IP.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("expected [2001:db8::1], got %+v", res)
+	}
+}
+
+func TestDnsaddrQueryApex(t *testing.T) {
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta},
+			"example.com":          {"v=spf1 -all", txtb},
+		},
+	}
+	ctx := context.Background()
+	maddr := ma.StringCast("/dnsaddr/example.com")
+
+	addrs, err := (&Resolver{def: mock}).Resolve(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(ip4ma) {
+		t.Fatalf("expected [%s], got %+v", ip4ma, addrs)
+	}
+
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithDnsaddrQueryApex(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err = resolver.Resolve(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || !addrs[0].Equal(ip4ma) || !addrs[1].Equal(ip6ma) {
+		t.Fatalf("expected [%s %s], got %+v", ip4ma, ip6ma, addrs)
+	}
+}
+
+func TestRecordingResolver(t *testing.T) {
+	rec := &RecordingResolver{
+		Resolver: &MockResolver{
+			IP: map[string][]net.IPAddr{
+				"example.com": {ip4a, ip6a},
+			},
+			TXT: map[string][]string{
+				"_dnsaddr.bootstrap.com": {"dnsaddr=/dns4/example.com/tcp/123"},
+			},
+		},
+	}
+	resolver := &Resolver{def: rec}
+
+	addrs, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dnsaddr/bootstrap.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(txtmd) {
+		t.Fatalf("expected [%s], got %+v", txtmd, addrs)
+	}
+
+	expected := []Lookup{
+		{Kind: LookupKindTXT, Name: "_dnsaddr.bootstrap.com"},
+		{Kind: LookupKindIPAddr, Name: "example.com"},
+	}
+	lookups := rec.Lookups()
+	if len(lookups) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, lookups)
+	}
+	for i := range expected {
+		if lookups[i] != expected[i] {
+			t.Fatalf("%d: expected %+v, got %+v", i, expected[i], lookups[i])
+		}
+	}
+}
+
+func TestDnsaddrMatchingNonCanonical(t *testing.T) {
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/ip4/192.0.2.1/tcp/0123",
+				"dnsaddr=/ip6/2001:0db8:0000::00a3/tcp/123",
+				"dnsaddr=/ip4/192.0.2.2/tcp/1230",
+			},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	addrs, err := resolver.Resolve(context.Background(), ma.StringCast("/dnsaddr/example.com/tcp/00123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ma.Multiaddr{
+		ma.Join(ip4ma, ma.StringCast("/tcp/123")),
+		ma.Join(ip6ma, ma.StringCast("/tcp/123")),
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, addrs)
+	}
+	for i := range expected {
+		if !expected[i].Equal(addrs[i]) {
+			t.Fatalf("%d: expected %s, got %s", i, expected[i], addrs[i])
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	resolver := makeResolver()
+
+	for _, s := range []string{"/dnsaddr/example.com", "/dns6/example.com/tcp/1", "/ip4/1.2.3.4"} {
+		if err := resolver.Validate(ctx, ma.StringCast(s)); err != nil {
+			t.Fatalf("expected %s to validate, got %s", s, err)
+		}
+	}
+	for _, s := range []string{"/dnsaddr/none.com", "/dns4/none.com", "/dnsaddr/example.com/quic/quic"} {
+		if err := resolver.Validate(ctx, ma.StringCast(s)); !errors.Is(err, ErrNoResolvableAddrs) {
+			t.Fatalf("expected ErrNoResolvableAddrs for %s, got %v", s, err)
+		}
+	}
+
+	failing := &Resolver{def: &failingResolver{}}
+	if err := failing.Validate(ctx, ma.StringCast("/dns4/example.com")); err == nil || errors.Is(err, ErrNoResolvableAddrs) {
+		t.Fatalf("expected the lookup error, got %v", err)
+	}
+}
+
+type failingResolver struct{}
+
+func (*failingResolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return nil, errors.New("lookup failed")
+}
+
+func (*failingResolver) LookupTXT(context.Context, string) ([]string, error) {
+	return nil, errors.New("lookup failed")
+}
+
+func TestResolveAllDelegation(t *testing.T) {
+	const (
+		foo = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+		bar = "/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+	)
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.a.com": {"dnsaddr=/dnsaddr/b.com" + foo},
+			"_dnsaddr.b.com": {"dnsaddr=/dnsaddr/c.com" + foo, "dnsaddr=/dnsaddr/a.com" + foo},
+			"_dnsaddr.c.com": {
+				"dnsaddr=" + txtmd.String() + foo,
+				"dnsaddr=" + ip6ma.String() + "/udp/123/quic-v1" + foo,
+				"dnsaddr=" + ip4mb.String() + "/tcp/123" + bar,
+			},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	addrs, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dnsaddr/a.com"+foo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ma.Multiaddr{
+		ma.Join(txtmd, ma.StringCast(foo)),
+		ma.Join(ip6ma, ma.StringCast("/udp/123/quic-v1"+foo)),
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, addrs)
+	}
+	for i := range expected {
+		if !expected[i].Equal(addrs[i]) {
+			t.Fatalf("%d: expected %s, got %s", i, expected[i], addrs[i])
+		}
+	}
+}
+
+func TestPerFamilyResolvers(t *testing.T) {
+	def := &RecordingResolver{Resolver: &MockResolver{
+		IP: map[string][]net.IPAddr{"example.com": {ip4b, ip6b}},
+	}}
+	v4 := &RecordingResolver{Resolver: &MockResolver{
+		IP: map[string][]net.IPAddr{"example.com": {ip4a, ip6b}},
+	}}
+	v6 := &RecordingResolver{Resolver: &MockResolver{
+		IP: map[string][]net.IPAddr{"example.com": {ip4b, ip6a}},
+	}}
+	custom := &MockResolver{
+		IP: map[string][]net.IPAddr{"custom.test": {ip4b, ip6b}},
+	}
+	resolver, err := NewResolver(
+		WithDefaultResolver(def),
+		WithIPv4Resolver(v4),
+		WithIPv6Resolver(v6),
+		WithDomainResolver("custom.test", custom),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		maddr    string
+		expected []ma.Multiaddr
+		v4, v6   int
+	}{
+		{"/dns4/example.com", []ma.Multiaddr{ip4ma}, 1, 0},
+		{"/dns6/example.com", []ma.Multiaddr{ip6ma}, 1, 1},
+		{"/dns/example.com", []ma.Multiaddr{ip4ma, ip6ma}, 2, 2},
+		{"/dns/custom.test", []ma.Multiaddr{ip4mb, ip6mb}, 2, 2},
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast(tc.maddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("%s: expected %+v, got %+v", tc.maddr, tc.expected, addrs)
+		}
+		for i := range tc.expected {
+			if !tc.expected[i].Equal(addrs[i]) {
+				t.Fatalf("%s: expected %s at %d, got %s", tc.maddr, tc.expected[i], i, addrs[i])
+			}
+		}
+		if n := len(v4.Lookups()); n != tc.v4 {
+			t.Fatalf("%s: expected %d IPv4 lookups in total, got %d", tc.maddr, tc.v4, n)
+		}
+		if n := len(v6.Lookups()); n != tc.v6 {
+			t.Fatalf("%s: expected %d IPv6 lookups in total, got %d", tc.maddr, tc.v6, n)
+		}
+	}
+	if n := len(def.Lookups()); n != 0 {
+		t.Fatalf("expected no lookups on the default resolver, got %d", n)
+	}
+}
+
+func TestStaticOverrides(t *testing.T) {
+	rec := &RecordingResolver{Resolver: makeResolver().def}
+	pinned := ma.StringCast("/ip4/198.51.100.1/tcp/4001")
+	peerA := ma.StringCast("/ip4/198.51.100.2/tcp/1/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx")
+	peerB := ma.StringCast("/ip4/198.51.100.3/tcp/1/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN")
+	resolver, err := NewResolver(
+		WithDefaultResolver(rec),
+		WithStaticOverrides(map[string][]ma.Multiaddr{
+			"pinned.com":  {pinned},
+			"example.com": {ip6mb},
+			"peers.com":   {peerA, peerB},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		maddr    string
+		expected []ma.Multiaddr
+	}{
+		{"/dnsaddr/pinned.com", []ma.Multiaddr{pinned}},
+		{"/dns4/Pinned.com./p2p-circuit", []ma.Multiaddr{ma.Join(pinned, ma.StringCast("/p2p-circuit"))}},
+		{"/dns/example.com", []ma.Multiaddr{ip6mb}},
+		{"/dnsaddr/matching.com/tcp/123", []ma.Multiaddr{txtmd}},
+		// dnsaddr overrides are matched against the suffix like TXT records.
+		{"/dnsaddr/peers.com/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx", []ma.Multiaddr{peerA}},
+		{"/dnsaddr/peers.com/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN", []ma.Multiaddr{peerB}},
+		{"/dnsaddr/peers.com/p2p/QmYyQSo1c1Ym7orWxLYvCrM2EmxFTANf8wXmmE7DWjhx5N", nil},
+		{"/dnsaddr/peers.com", []ma.Multiaddr{peerA, peerB}},
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast(tc.maddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("%s: expected %+v, got %+v", tc.maddr, tc.expected, addrs)
+		}
+		for i := range tc.expected {
+			if !tc.expected[i].Equal(addrs[i]) {
+				t.Fatalf("%s: expected %s at %d, got %s", tc.maddr, tc.expected[i], i, addrs[i])
+			}
+		}
+	}
+
+	lookups := rec.Lookups()
+	if len(lookups) != 1 || lookups[0].Name != "_dnsaddr.matching.com" {
+		t.Fatalf("expected only the non-overridden name to be looked up, got %+v", lookups)
+	}
+}
+
+func TestResolveComponents(t *testing.T) {
+	ctx := context.Background()
+	resolver := makeResolver()
+
+	for _, s := range []string{
+		"/dns4/example.com",
+		"/dns/example.com/tcp/123",
+		"/quic/dns6/example.com/dns4/example.com/http",
+		"/dnsaddr/matching.com/tcp/123",
+		"/dnsaddr/none.com",
+		"/ip4/1.2.3.4/tcp/123",
+	} {
+		maddr := ma.StringCast(s)
+		var comps []ma.Component
+		ma.ForEach(maddr, func(c ma.Component) bool {
+			comps = append(comps, c)
+			return true
+		})
+
+		expected, err := resolver.Resolve(ctx, maddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := resolver.ResolveComponents(ctx, comps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != len(expected) {
+			t.Fatalf("%s: expected %+v, got %+v", s, expected, actual)
+		}
+		for i := range expected {
+			if !expected[i].Equal(actual[i]) {
+				t.Fatalf("%s: expected %s at %d, got %s", s, expected[i], i, actual[i])
+			}
+		}
+	}
+
+	addrs, err := resolver.ResolveComponents(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) > 0 {
+		t.Fatalf("expected [], got %+v", addrs)
+	}
+}
+
+func TestMaxTXTBytes(t *testing.T) {
+	huge := "dnsaddr=/dns4/" + strings.Repeat("a", 60) + "." + strings.Repeat("b", 4096)
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta, huge, txtb},
+		},
+	}
+	maddr := ma.StringCast("/dnsaddr/example.com")
+
+	// the huge record is over the default length limit of a single record.
+	unlimited, err := NewResolver(WithDefaultResolver(mock), WithMaxTXTRecordLen(len(huge)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := unlimited.Resolve(context.Background(), maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 3 {
+		t.Fatalf("expected 3 addresses without a limit, got %d", len(addrs))
+	}
+
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithMaxTXTBytes(1024), WithMaxTXTRecordLen(len(huge)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, meta, err := resolver.ResolveWithMeta(context.Background(), maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(ip4ma) {
+		t.Fatalf("expected [%s], got %+v", ip4ma, addrs)
+	}
+	// the records left out are reported.
+	if len(meta.RecordErrors) != 2 {
+		t.Fatalf("expected 2 record errors, got %+v", meta.RecordErrors)
+	}
+	for i, e := range []string{huge, txtb} {
+		if re := meta.RecordErrors[i]; re.Record != e || !errors.Is(&re, ErrTXTBudgetExceeded) {
+			t.Fatalf("%d: expected %.20q to be over budget, got %.20q: %v", i, e, re.Record, re.Err)
+		}
+	}
+
+	if _, err := NewResolver(WithMaxTXTBytes(-1)); err == nil {
+		t.Fatal("expected a budget of -1 to be rejected")
+	}
+}
+
+func TestMaxTXTRecordLen(t *testing.T) {
+	long := "dnsaddr=/dns4/" + strings.Repeat("a", 60) + "." + strings.Repeat("b", defaultMaxTXTRecordLen)
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta, long, txtb},
+		},
+	}
+	maddr := ma.StringCast("/dnsaddr/example.com")
+
+	addrs, meta, err := (&Resolver{def: mock}).ResolveWithMeta(context.Background(), maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || !addrs[0].Equal(ip4ma) || !addrs[1].Equal(ip6ma) {
+		t.Fatalf("expected [%s %s], got %+v", ip4ma, ip6ma, addrs)
+	}
+	if len(meta.RecordErrors) != 1 || !errors.Is(meta.RecordErrors[0].Err, ErrRecordTooLong) {
+		t.Fatalf("expected the long record to be reported, got %+v", meta.RecordErrors)
+	}
+
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithMaxTXTRecordLen(len(txta)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err = resolver.Resolve(context.Background(), maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(ip4ma) {
+		t.Fatalf("expected [%s], got %+v", ip4ma, addrs)
+	}
+
+	if _, err := NewResolver(WithMaxTXTRecordLen(0)); err == nil {
+		t.Fatal("expected a length limit of 0 to be rejected")
+	}
+}
+
+func TestDnsaddrUnmapIPv4(t *testing.T) {
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/ip6/::ffff:192.0.2.1/tcp/123",
+				"dnsaddr=/ip6/2001:db8::a3/tcp/123",
+				"dnsaddr=/ip4/192.0.2.2/tcp/123/p2p-circuit/ip6/::ffff:192.0.2.1",
+			},
+		},
+	}
+	maddr := ma.StringCast("/dnsaddr/example.com")
+	ctx := context.Background()
+
+	addrs, err := (&Resolver{def: mock}).Resolve(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := ma.StringCast("/ip6/::ffff:192.0.2.1/tcp/123"); len(addrs) != 3 || !addrs[0].Equal(expected) {
+		t.Fatalf("expected records as published, got %+v", addrs)
+	}
+
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithDnsaddrUnmapIPv4(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err = resolver.Resolve(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ma.Multiaddr{
+		txtmd,
+		ma.Join(ip6ma, ma.StringCast("/tcp/123")),
+		ma.StringCast("/ip4/192.0.2.2/tcp/123/p2p-circuit/ip4/192.0.2.1"),
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, addrs)
+	}
+	for i := range expected {
+		if !expected[i].Equal(addrs[i]) {
+			t.Fatalf("%d: expected %s, got %s", i, expected[i], addrs[i])
+		}
+	}
+}
+
+func TestPortSuffix(t *testing.T) {
+	ctx := context.Background()
+	maddr := ma.StringCast("/dns4/example.com:4001/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx")
+
+	_, err := makeResolver().Resolve(ctx, maddr)
+	if !errors.Is(err, ErrPortInDomain) {
+		t.Fatalf("expected ErrPortInDomain, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "/dns4/example.com/tcp/4001") {
+		t.Fatalf("expected the error to suggest the correct form, got %q", err)
+	}
+
+	resolver, err := NewResolver(WithDefaultResolver(makeResolver().def), WithLenientPortSuffix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := resolver.Resolve(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suffix := ma.StringCast("/tcp/4001/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx")
+	if len(addrs) != 2 || !addrs[0].Equal(ma.Join(ip4ma, suffix)) || !addrs[1].Equal(ma.Join(ip4mb, suffix)) {
+		t.Fatalf("expected [%s %s], got %+v", ma.Join(ip4ma, suffix), ma.Join(ip4mb, suffix), addrs)
+	}
+
+	// dnsaddr records are matched on what follows the component, so it isn't rewritten.
+	_, err = resolver.Resolve(ctx, ma.StringCast("/dnsaddr/example.com:4001"))
+	if !errors.Is(err, ErrPortInDomain) {
+		t.Fatalf("expected ErrPortInDomain, got %v", err)
+	}
+	if strings.Contains(err.Error(), "/tcp/") {
+		t.Fatalf("expected no /tcp suggestion for dnsaddr, got %q", err)
+	}
+
+	// IPv6 literals aren't mistaken for a port.
+	addrs, err = resolver.Resolve(ctx, ma.StringCast("/dns6/2001:db8::1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(ma.StringCast("/ip6/2001:db8::1")) {
+		t.Fatalf("expected [/ip6/2001:db8::1], got %+v", addrs)
+	}
+}
+
+func TestDnsaddrLowercaseDomains(t *testing.T) {
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/dns4/Example.COM/tcp/123",
+				"dnsaddr=/ip4/192.0.2.1/tcp/123/p2p-circuit/dnsaddr/Relay.Example.com",
+			},
+		},
+	}
+	maddr := ma.StringCast("/dnsaddr/example.com")
+	ctx := context.Background()
+
+	addrs, err := (&Resolver{def: mock}).Resolve(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ma.Multiaddr{
+		ma.StringCast("/dns4/example.com/tcp/123"),
+		ma.StringCast("/ip4/192.0.2.1/tcp/123/p2p-circuit/dnsaddr/relay.example.com"),
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, addrs)
+	}
+	for i := range expected {
+		if !expected[i].Equal(addrs[i]) {
+			t.Fatalf("%d: expected %s, got %s", i, expected[i], addrs[i])
+		}
+	}
+
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithPreserveDomainCase())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err = resolver.Resolve(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := ma.StringCast("/dns4/Example.COM/tcp/123"); len(addrs) != 2 || !addrs[0].Equal(expected) {
+		t.Fatalf("expected %s first, got %+v", expected, addrs)
+	}
+}
+
+func TestMinResolvedAddrs(t *testing.T) {
+	resolver, err := NewResolver(WithDefaultResolver(makeResolver().def), WithMinResolvedAddrs(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	addrs, err := resolver.Resolve(ctx, ma.StringCast("/dns4/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 addresses, got %+v", addrs)
+	}
+
+	addrs, err = resolver.Resolve(ctx, ma.StringCast("/dnsaddr/matching.com/tcp/123"))
+	if !errors.Is(err, ErrInsufficientAddrs) {
+		t.Fatalf("expected ErrInsufficientAddrs, got %v", err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(txtmd) {
+		t.Fatalf("expected the partial result [%s], got %+v", txtmd, addrs)
+	}
+
+	addrs, err = resolver.Resolve(ctx, ma.StringCast("/dnsaddr/none.com"))
+	if !errors.Is(err, ErrInsufficientAddrs) || len(addrs) != 0 {
+		t.Fatalf("expected ErrInsufficientAddrs and no addresses, got %+v (%v)", addrs, err)
+	}
+
+	// there is nothing to resolve, so there is no minimum to enforce.
+	if _, err := resolver.Resolve(ctx, ip4ma); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMinResolvedAddrsFinalResult(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{"example.com": {ip4a, ip4b}},
+		TXT: map[string][]string{
+			"_dnsaddr.single.com": {"dnsaddr=/dns4/example.com/tcp/123"},
+		},
+	}
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithMinResolvedAddrs(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	maddr := ma.StringCast("/dnsaddr/single.com")
+
+	// on its own, the single record is too few.
+	if _, err := resolver.Resolve(ctx, maddr); !errors.Is(err, ErrInsufficientAddrs) {
+		t.Fatalf("expected ErrInsufficientAddrs, got %v", err)
+	}
+
+	// but it expands into enough addresses.
+	addrs, err := resolver.ResolveAll(ctx, maddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 addresses, got %+v", addrs)
+	}
+	if err := resolver.Validate(ctx, maddr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.ResolvePeerAddrs(ctx, []ma.Multiaddr{maddr}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolver.ResolveNetAddrs(ctx, maddr); err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err = NewResolver(WithDefaultResolver(mock), WithMinResolvedAddrs(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err = resolver.ResolveAll(ctx, maddr)
+	if !errors.Is(err, ErrInsufficientAddrs) || len(addrs) != 2 {
+		t.Fatalf("expected ErrInsufficientAddrs with 2 addresses, got %+v (%v)", addrs, err)
+	}
+	if err := resolver.Validate(ctx, maddr); !errors.Is(err, ErrInsufficientAddrs) {
+		t.Fatalf("expected ErrInsufficientAddrs, got %v", err)
+	}
+}
+
+func TestDnsaddrMatchingCerthash(t *testing.T) {
+	const (
+		certa = "/certhash/uEiDDq4_xNyDorZBH3TlGazyJdOWSwvo4PUo5YHFMrvDE8g"
+		certb = "/certhash/uEiAkH5a4DPGKUuOBjYw0CgwjvcJCJMD2K_1aluKR_tpevQ"
+		p2p   = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	)
+	wt := ma.StringCast("/ip4/192.0.2.1/udp/443/quic-v1/webtransport" + certa + certb + p2p)
+	wtSame := ma.StringCast("/ip6/2001:db8::a3/udp/443/quic-v1/webtransport" + certb + certb + p2p)
+	quic := ma.StringCast("/ip4/192.0.2.2/udp/443/quic-v1" + p2p)
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {"dnsaddr=" + wt.String(), "dnsaddr=" + wtSame.String(), "dnsaddr=" + quic.String()},
+		},
+	}
+	resolver := &Resolver{def: mock}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		suffix   string
+		expected []ma.Multiaddr
+	}{
+		{p2p, []ma.Multiaddr{wt, wtSame, quic}},
+		{certb + p2p, []ma.Multiaddr{wt, wtSame}},
+		{certa + certb + p2p, []ma.Multiaddr{wt}},
+		{certb + certb + p2p, []ma.Multiaddr{wtSame}},
+		{"/webtransport" + certa + certb + p2p, []ma.Multiaddr{wt}},
+		{"/udp/443/quic-v1/webtransport" + certb + certb + p2p, []ma.Multiaddr{wtSame}},
+		{certb + certa + p2p, nil},
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast("/dnsaddr/example.com"+tc.suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("%s: expected %+v, got %+v", tc.suffix, tc.expected, addrs)
+		}
+		for i := range tc.expected {
+			if !tc.expected[i].Equal(addrs[i]) {
+				t.Fatalf("%s: expected %s at %d, got %s", tc.suffix, tc.expected[i], i, addrs[i])
+			}
+		}
+	}
+}
+
+func TestDnsaddrTransportFilter(t *testing.T) {
+	const p2p = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	records := []string{
+		"/ip4/192.0.2.1/tcp/4001" + p2p,
+		"/ip4/192.0.2.1/udp/4001/quic-v1" + p2p,
+		"/ip4/192.0.2.1/udp/4001/quic-v1/webtransport/certhash/uEiDDq4_xNyDorZBH3TlGazyJdOWSwvo4PUo5YHFMrvDE8g" + p2p,
+		"/ip6/2001:db8::a3/tcp/4002/ws" + p2p,
+	}
+	mock := &MockResolver{TXT: map[string][]string{"_dnsaddr.example.com": {}}}
+	for _, rec := range records {
+		mock.TXT["_dnsaddr.example.com"] = append(mock.TXT["_dnsaddr.example.com"], "dnsaddr="+rec)
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		transports []string
+		expected   []string
+	}{
+		{[]string{"tcp"}, []string{records[0], records[3]}},
+		{[]string{"quic-v1"}, []string{records[1], records[2]}},
+		{[]string{"webtransport", "ws"}, []string{records[2], records[3]}},
+	} {
+		resolver, err := NewResolver(WithDefaultResolver(mock), WithDnsaddrTransportFilter(tc.transports))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := resolver.Resolve(ctx, ma.StringCast("/dnsaddr/example.com"+p2p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("%v: expected %+v, got %+v", tc.transports, tc.expected, addrs)
+		}
+		for i, e := range tc.expected {
+			if addrs[i].String() != e {
+				t.Fatalf("%v: expected %s at %d, got %s", tc.transports, e, i, addrs[i])
+			}
+		}
+	}
+
+	if _, err := NewResolver(WithDnsaddrTransportFilter([]string{"carrier-pigeon"})); err == nil {
+		t.Fatal("expected an unknown transport to be rejected")
+	}
+}
+
+// inFlightResolver tracks the maximum number of TXT lookups in flight at once.
+type inFlightResolver struct {
+	BasicResolver
+
+	cur, max atomic.Int32
+}
+
+func (r *inFlightResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	n := r.cur.Add(1)
+	defer r.cur.Add(-1)
+	for {
+		m := r.max.Load()
+		if n <= m || r.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return r.BasicResolver.LookupTXT(ctx, name)
+}
+
+func TestResolveAllConcurrency(t *testing.T) {
+	const hosts = 6
+	mock := &MockResolver{TXT: map[string][]string{}}
+	var expected []string
+	for i := 0; i < hosts; i++ {
+		host := "h" + strconv.Itoa(i) + ".com"
+		addr := "/ip4/192.0.2." + strconv.Itoa(i+1) + "/tcp/4001"
+		mock.TXT["_dnsaddr.a.com"] = append(mock.TXT["_dnsaddr.a.com"], "dnsaddr=/dnsaddr/"+host)
+		mock.TXT["_dnsaddr."+host] = []string{"dnsaddr=" + addr}
+		expected = append(expected, addr)
+	}
+
+	for _, limit := range []int{1, 2, hosts} {
+		backend := &inFlightResolver{BasicResolver: mock}
+		resolver, err := NewResolver(WithDefaultResolver(backend), WithMaxConcurrency(limit))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dnsaddr/a.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(expected) {
+			t.Fatalf("limit %d: expected %v, got %+v", limit, expected, addrs)
+		}
+		for i, e := range expected {
+			if addrs[i].String() != e {
+				t.Fatalf("limit %d: expected %s at %d, got %s", limit, e, i, addrs[i])
+			}
+		}
+		if max := int(backend.max.Load()); max > limit {
+			t.Fatalf("limit %d: %d lookups were in flight at once", limit, max)
+		}
+	}
+
+	if _, err := NewResolver(WithMaxConcurrency(0)); err == nil {
+		t.Fatal("expected a concurrency limit of 0 to be rejected")
+	}
+}
+
+func TestMaxCrossProduct(t *testing.T) {
+	mock := &MockResolver{IP: map[string][]net.IPAddr{}}
+	for _, host := range []string{"a.com", "b.com", "c.com"} {
+		for i := 1; i <= 5; i++ {
+			mock.IP[host] = append(mock.IP[host], net.IPAddr{IP: net.IPv4(192, 0, 2, byte(i))})
+		}
+	}
+	maddr := ma.StringCast("/dns4/a.com/tcp/1/dns4/b.com/tcp/2/dns4/c.com/tcp/3")
+
+	for _, tc := range []struct {
+		opts  []Option
+		addrs int
+	}{
+		// 5 * 5 * 5 = 125, capped at maxResolvedAddrs.
+		{nil, maxResolvedAddrs},
+		// Only 10 of the 25 /dns4/c.com addresses are carried over to the last round.
+		{[]Option{WithMaxCrossProduct(10)}, 50},
+	} {
+		resolver, err := NewResolver(append(tc.opts, WithDefaultResolver(mock))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := resolver.ResolveAll(context.Background(), maddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != tc.addrs {
+			t.Fatalf("expected %d addresses, got %d", tc.addrs, len(addrs))
+		}
+		if !addrs[0].Equal(ma.StringCast("/ip4/192.0.2.1/tcp/1/ip4/192.0.2.1/tcp/2/ip4/192.0.2.1/tcp/3")) {
+			t.Fatalf("unexpected first address %s", addrs[0])
+		}
+	}
+
+	if _, err := NewResolver(WithMaxCrossProduct(0)); err == nil {
+		t.Fatal("expected a cross product limit of 0 to be rejected")
+	}
+}
+
+func TestResolveOrdering(t *testing.T) {
+	ctx := context.Background()
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip6b, ip4b, ip6a, ip4a},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txtb, txte, txta, txtc},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	for _, tc := range []struct {
+		maddr    string
+		expected []ma.Multiaddr
+	}{
+		{"/dns/example.com", []ma.Multiaddr{ip6mb, ip4mb, ip6ma, ip4ma}},
+		{"/dns4/example.com", []ma.Multiaddr{ip4mb, ip4ma}},
+		{"/dns6/example.com", []ma.Multiaddr{ip6mb, ip6ma}},
+		{"/dnsaddr/example.com", []ma.Multiaddr{ip6ma, txtme, ip4ma, txtmc}},
+	} {
+		for i := 0; i < 50; i++ {
+			addrs, err := resolver.ResolveAll(ctx, ma.StringCast(tc.maddr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(addrs) != len(tc.expected) {
+				t.Fatalf("%s: expected %+v, got %+v", tc.maddr, tc.expected, addrs)
+			}
+			for j, e := range tc.expected {
+				if !addrs[j].Equal(e) {
+					t.Fatalf("%s: expected %s at %d, got %s", tc.maddr, e, j, addrs[j])
+				}
+			}
+		}
+	}
+}
+
+func TestDnsaddrMatchingHTTP(t *testing.T) {
+	const p2p = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	tlsHTTP := ma.StringCast("/ip4/192.0.2.1/tcp/443/tls/http" + p2p)
+	https := ma.StringCast("/ip4/192.0.2.2/tcp/443/https")
+	path := ma.StringCast("/ip6/2001:db8::a3/tcp/443/tls/http/http-path/foo%2Fbar")
+	otherPath := ma.StringCast("/ip6/2001:db8::a4/tcp/443/tls/http/http-path/foo")
+	mock := &MockResolver{TXT: map[string][]string{"_dnsaddr.example.com": {}}}
+	for _, m := range []ma.Multiaddr{tlsHTTP, https, path, otherPath} {
+		mock.TXT["_dnsaddr.example.com"] = append(mock.TXT["_dnsaddr.example.com"], "dnsaddr="+m.String())
+	}
+	resolver := &Resolver{def: mock}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		suffix   string
+		expected []ma.Multiaddr
+	}{
+		{"/http" + p2p, []ma.Multiaddr{tlsHTTP}},
+		{"/tls/http" + p2p, []ma.Multiaddr{tlsHTTP}},
+		{"/tcp/443/tls/http" + p2p, []ma.Multiaddr{tlsHTTP}},
+		{"/https", []ma.Multiaddr{https}},
+		{"/tls/http", nil},
+		{"/http-path/foo%2Fbar", []ma.Multiaddr{path}},
+		{"/tls/http/http-path/foo%2Fbar", []ma.Multiaddr{path}},
+		{"/http-path/foo", []ma.Multiaddr{otherPath}},
+		{"/http-path/bar", nil},
+	} {
+		addrs, err := resolver.Resolve(ctx, ma.StringCast("/dnsaddr/example.com"+tc.suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("%s: expected %+v, got %+v", tc.suffix, tc.expected, addrs)
+		}
+		for i := range tc.expected {
+			if !tc.expected[i].Equal(addrs[i]) {
+				t.Fatalf("%s: expected %s at %d, got %s", tc.suffix, tc.expected[i], i, addrs[i])
+			}
+		}
+	}
+}
+
+func TestResolvePeerAddrs(t *testing.T) {
+	const (
+		foo = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+		bar = "/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+	)
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{"bar.com": {ip4b}},
+		TXT: map[string][]string{
+			"_dnsaddr.a.com": {
+				"dnsaddr=/ip4/192.0.2.1/tcp/4001" + foo,
+				"dnsaddr=/ip6/2001:db8::a3/tcp/4001" + foo,
+				"dnsaddr=/dns4/bar.com/tcp/4001" + bar,
+			},
+			"_dnsaddr.b.com": {
+				"dnsaddr=/ip6/2001:db8::a3/tcp/4001" + foo,
+				"dnsaddr=/ip4/192.0.2.1/udp/4001/quic-v1" + foo,
+			},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	addrs, err := resolver.ResolvePeerAddrs(context.Background(), []ma.Multiaddr{
+		ma.StringCast("/dnsaddr/a.com"),
+		ma.StringCast("/dnsaddr/b.com" + foo),
+		ma.StringCast("/ip4/192.0.2.9/tcp/1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"/ip4/192.0.2.1/tcp/4001" + foo,
+		"/ip6/2001:db8::a3/tcp/4001" + foo,
+		"/ip4/192.0.2.1/udp/4001/quic-v1" + foo,
+		"/ip4/192.0.2.2/tcp/4001" + bar,
+		"/ip4/192.0.2.9/tcp/1",
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %v, got %+v", expected, addrs)
+	}
+	for i, e := range expected {
+		if addrs[i].String() != e {
+			t.Fatalf("expected %s at %d, got %s", e, i, addrs[i])
+		}
+	}
+
+	failing := &Resolver{def: &failingResolver{}}
+	if _, err := failing.ResolvePeerAddrs(context.Background(), []ma.Multiaddr{ma.StringCast("/dnsaddr/a.com")}); err == nil {
+		t.Fatal("expected resolution to fail")
+	}
+}
+
+func TestResolveDedup(t *testing.T) {
+	const (
+		foo = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+		bar = "/p2p/QmNnooDu7bfjPFoTZYxMNLWUQJyrVwtbZg5gBMjTezGAJN"
+	)
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip4a, ip4a, ip6a},
+			"b.com":       {ip4a},
+			"c.com":       {ip4a},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta, txta, "dnsaddr=/dns4/B.com", "dnsaddr=/dns4/b.com"},
+			"_dnsaddr.peers.com":   {"dnsaddr=/ip4/192.0.2.1/tcp/1" + foo, "dnsaddr=/ip4/192.0.2.1/tcp/1" + bar},
+			"_dnsaddr.a.com":       {"dnsaddr=/dns4/b.com/tcp/1", "dnsaddr=/dns4/c.com/tcp/1"},
+		},
+	}
+	ctx := context.Background()
+	resolver, err := NewResolver(WithDefaultResolver(mock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripping, err := NewResolver(WithDefaultResolver(mock), WithStripPeerIDs())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		resolver *Resolver
+		maddr    string
+		all      bool
+		expected []string
+	}{
+		{resolver, "/dns4/example.com", false, []string{"/ip4/192.0.2.1"}},
+		{resolver, "/dnsaddr/example.com", false, []string{"/ip4/192.0.2.1", "/dns4/b.com"}},
+		{stripping, "/dnsaddr/peers.com", false, []string{"/ip4/192.0.2.1/tcp/1"}},
+		// example.com has the same address as both b.com and c.com.
+		{resolver, "/dns/example.com/tcp/1/dns4/b.com/tcp/2", true, []string{
+			"/ip4/192.0.2.1/tcp/1/ip4/192.0.2.1/tcp/2",
+			"/ip6/2001:db8::a3/tcp/1/ip4/192.0.2.1/tcp/2",
+		}},
+		{resolver, "/dnsaddr/a.com", true, []string{"/ip4/192.0.2.1/tcp/1"}},
+	} {
+		var addrs []ma.Multiaddr
+		if tc.all {
+			addrs, err = tc.resolver.ResolveAll(ctx, ma.StringCast(tc.maddr))
+		} else {
+			addrs, err = tc.resolver.Resolve(ctx, ma.StringCast(tc.maddr))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("%s: expected %v, got %+v", tc.maddr, tc.expected, addrs)
+		}
+		for i, e := range tc.expected {
+			if addrs[i].String() != e {
+				t.Fatalf("%s: expected %s at %d, got %s", tc.maddr, e, i, addrs[i])
+			}
+		}
+	}
+}
+
+func TestTXTRecordValidator(t *testing.T) {
+	const p2p = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	withPeer := "/ip4/192.0.2.1/tcp/4001" + p2p
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txta, "dnsaddr=" + withPeer, txtc},
+		},
+	}
+	var seen []string
+	requirePeerID := func(raw string, parsed ma.Multiaddr) bool {
+		seen = append(seen, raw)
+		_, p2p := splitPeerID(parsed)
+		return p2p != nil
+	}
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithTXTRecordValidator(requirePeerID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, meta, err := resolver.ResolveWithMeta(context.Background(), ma.StringCast("/dnsaddr/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || addrs[0].String() != withPeer {
+		t.Fatalf("expected [%s], got %+v", withPeer, addrs)
+	}
+	if len(seen) != 3 || seen[1] != "dnsaddr="+withPeer {
+		t.Fatalf("expected the validator to see the raw records, got %v", seen)
+	}
+	if len(meta.RecordErrors) != 2 {
+		t.Fatalf("expected 2 rejected records, got %+v", meta.RecordErrors)
+	}
+	for _, re := range meta.RecordErrors {
+		if !errors.Is(re.Err, ErrRecordRejected) {
+			t.Fatalf("expected %q to be rejected, got %v", re.Record, re.Err)
+		}
+	}
+}
+
+func TestDefaultPort(t *testing.T) {
+	const p2p = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/ip4/192.0.2.1",
+				"dnsaddr=/ip6/2001:db8::a3" + p2p,
+				"dnsaddr=/dns4/node.example.com" + p2p,
+				"dnsaddr=/ip4/192.0.2.2/tcp/443/wss" + p2p,
+				"dnsaddr=/ip4/192.0.2.3/udp/443/quic-v1" + p2p,
+				"dnsaddr=/dnsaddr/other.com",
+			},
+		},
+	}
+	resolver, err := NewResolver(WithDefaultResolver(mock), WithDefaultPort("tcp", 4001))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := resolver.Resolve(context.Background(), ma.StringCast("/dnsaddr/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"/ip4/192.0.2.1/tcp/4001",
+		"/ip6/2001:db8::a3/tcp/4001" + p2p,
+		"/dns4/node.example.com/tcp/4001" + p2p,
+		"/ip4/192.0.2.2/tcp/443/wss" + p2p,
+		"/ip4/192.0.2.3/udp/443/quic-v1" + p2p,
+		"/dnsaddr/other.com",
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %v, got %+v", expected, addrs)
+	}
+	for i, e := range expected {
+		if addrs[i].String() != e {
+			t.Fatalf("expected %s at %d, got %s", e, i, addrs[i])
+		}
+	}
+
+	for _, tc := range []struct {
+		proto string
+		port  int
+	}{{"quic-v1", 4001}, {"tcp", 70000}, {"udp", -1}} {
+		if _, err := NewResolver(WithDefaultPort(tc.proto, tc.port)); err == nil {
+			t.Fatalf("expected /%s/%d to be rejected", tc.proto, tc.port)
+		}
+	}
+}
+
+func TestAltNamingRouting(t *testing.T) {
+	ens := &RecordingResolver{Resolver: &MockResolver{
+		TXT: map[string][]string{"_dnsaddr.peer.eth": {txta}},
+	}}
+	system := &RecordingResolver{Resolver: makeResolver().def}
+	resolver, err := NewResolver(WithDefaultResolver(system), WithDomainResolver("eth", ens))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	addrs, err := resolver.Resolve(ctx, ma.StringCast("/dnsaddr/peer.eth"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 1 || !addrs[0].Equal(ip4ma) {
+		t.Fatalf("expected [%s], got %+v", ip4ma, addrs)
+	}
+	addrs, err = resolver.Resolve(ctx, ma.StringCast("/dnsaddr/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("expected 2 addresses, got %+v", addrs)
+	}
+
+	if l := ens.Lookups(); len(l) != 1 || l[0].Name != "_dnsaddr.peer.eth" {
+		t.Fatalf("expected only the .eth name on the custom backend, got %+v", l)
+	}
+	if l := system.Lookups(); len(l) != 1 || l[0].Name != "_dnsaddr.example.com" {
+		t.Fatalf("expected only the .com name on the default backend, got %+v", l)
+	}
+}
+
+func TestResolveNetAddrs(t *testing.T) {
+	const p2p = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{"example.com": {ip4a, ip6a}},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/dns/example.com/tcp/4001" + p2p,
+				"dnsaddr=/ip4/192.0.2.2/udp/53",
+				"dnsaddr=/ip4/192.0.2.2/udp/4001/quic-v1" + p2p,
+				"dnsaddr=/ip4/192.0.2.2/tcp/4001" + p2p + "/p2p-circuit",
+				"dnsaddr=/ip4/192.0.2.2",
+			},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	addrs, err := resolver.ResolveNetAddrs(context.Background(), ma.StringCast("/dnsaddr/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []net.Addr{
+		&net.UDPAddr{IP: ip4b.IP, Port: 53},
+		&net.TCPAddr{IP: ip4a.IP, Port: 4001},
+		&net.TCPAddr{IP: ip6a.IP, Port: 4001},
+	}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, addrs)
+	}
+	for i, e := range expected {
+		if addrs[i].Network() != e.Network() || addrs[i].String() != e.String() {
+			t.Fatalf("expected %s %s at %d, got %s %s", e.Network(), e, i, addrs[i].Network(), addrs[i])
+		}
+	}
+}
+
+func TestPreferPeerIDRecords(t *testing.T) {
+	const p2p = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	mock := &MockResolver{
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {
+				"dnsaddr=/ip4/192.0.2.1/tcp/1",
+				"dnsaddr=/ip4/192.0.2.2/tcp/1" + p2p,
+				"dnsaddr=/ip6/2001:db8::a3/tcp/1",
+				"dnsaddr=/ip6/2001:db8::a4/tcp/1" + p2p,
+			},
+		},
+	}
+	maddr := ma.StringCast("/dnsaddr/example.com")
+
+	for _, tc := range []struct {
+		strict   bool
+		expected []string
+	}{
+		{false, []string{
+			"/ip4/192.0.2.2/tcp/1" + p2p,
+			"/ip6/2001:db8::a4/tcp/1" + p2p,
+			"/ip4/192.0.2.1/tcp/1",
+			"/ip6/2001:db8::a3/tcp/1",
+		}},
+		{true, []string{
+			"/ip4/192.0.2.2/tcp/1" + p2p,
+			"/ip6/2001:db8::a4/tcp/1" + p2p,
+		}},
+	} {
+		resolver, err := NewResolver(WithDefaultResolver(mock), WithPreferPeerIDRecords(tc.strict))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := resolver.Resolve(context.Background(), maddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != len(tc.expected) {
+			t.Fatalf("strict=%t: expected %v, got %+v", tc.strict, tc.expected, addrs)
+		}
+		for i, e := range tc.expected {
+			if addrs[i].String() != e {
+				t.Fatalf("strict=%t: expected %s at %d, got %s", tc.strict, e, i, addrs[i])
+			}
+		}
+	}
+}
+
+func BenchmarkResolveDnsaddr(b *testing.B) {
+	const p2p = "/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx"
+	var records []string
+	for i := 0; i < 50; i++ {
+		records = append(records, "dnsaddr=/ip4/192.0.2."+strconv.Itoa(i)+"/tcp/4001"+p2p)
+		records = append(records, "dnsaddr=/ip6/2001:db8::"+strconv.Itoa(i)+"/udp/4001/quic-v1"+p2p)
+	}
+	mock := &MockResolver{TXT: map[string][]string{"_dnsaddr.example.com": records}}
+	resolver := &Resolver{def: mock}
+	ctx := context.Background()
+
+	for _, bc := range []struct {
+		name  string
+		maddr ma.Multiaddr
+	}{
+		{"all", ma.StringCast("/dnsaddr/example.com")},
+		{"suffix", ma.StringCast("/dnsaddr/example.com/udp/4001/quic-v1" + p2p)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := resolver.Resolve(ctx, bc.maddr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkResolveDns4(b *testing.B) {
+	var ipaddrs []net.IPAddr
+	for i := 0; i < 255; i++ {
+		ipaddrs = append(ipaddrs, net.IPAddr{IP: net.ParseIP("1.2.3." + strconv.Itoa(i))})
+	}
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {ip4a},
+			"large.com":   ipaddrs,
+		},
+	}
+	resolver := &Resolver{def: mock}
+	ctx := context.Background()
+
+	for _, bc := range []struct {
+		name  string
+		maddr ma.Multiaddr
+	}{
+		{"single", ma.StringCast("/dns4/example.com/tcp/4001")},
+		{"large", ma.StringCast("/dns4/large.com/tcp/4001")},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := resolver.Resolve(ctx, bc.maddr); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkResolveCrossProduct(b *testing.B) {
+	mock := &MockResolver{IP: map[string][]net.IPAddr{}}
+	for _, host := range []string{"a.com", "b.com", "c.com"} {
+		for i := 1; i <= 5; i++ {
+			mock.IP[host] = append(mock.IP[host], net.IPAddr{IP: net.IPv4(192, 0, 2, byte(i))})
+		}
+	}
+	resolver := &Resolver{def: mock}
+	maddr := ma.StringCast("/dns4/a.com/tcp/1/dns4/b.com/tcp/2/dns4/c.com/tcp/3")
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := resolver.ResolveAll(ctx, maddr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMatches(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		maddr ma.Multiaddr
+	}{
+		{"dnsaddr", ma.StringCast("/dnsaddr/example.com/p2p/QmSoLju6m7xTh3DuokvT3886QRYqxAzb1kShaanJgW36yx")},
+		{"trailing", ma.StringCast("/ip4/192.0.2.1/tcp/443/tls/sni/example.com/ws/dns4/example.com")},
+		{"none", ma.StringCast("/ip4/192.0.2.1/udp/4001/quic-v1/webtransport")},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Matches(bc.maddr)
+			}
+		})
+	}
+}
+
+func TestZonesStripped(t *testing.T) {
+	mock := &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com": {{IP: net.ParseIP("fe80::1"), Zone: "eth0"}, ip4a},
+		},
+	}
+	resolver := &Resolver{def: mock}
+
+	addrs, err := resolver.Resolve(context.Background(), ma.StringCast("/dns/example.com/tcp/1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || addrs[0].String() != "/ip6/fe80::1/tcp/1" {
+		t.Fatalf("expected the zone to be dropped, got %+v", addrs)
+	}
+}
+
+// eventuallyConsistentResolver answers TXT lookups with nothing until it has been asked enough
+// times.
+type eventuallyConsistentResolver struct {
+	BasicResolver
+	emptyAnswers int
+
+	lookups atomic.Int32
+}
+
+func (r *eventuallyConsistentResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if int(r.lookups.Add(1)) <= r.emptyAnswers {
+		return nil, nil
+	}
+	return r.BasicResolver.LookupTXT(ctx, name)
+}
+
+func TestRetryOnEmpty(t *testing.T) {
+	maddr := ma.StringCast("/dnsaddr/example.com")
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		emptyAnswers, attempts int
+		addrs                  int
+		lookups                int32
+	}{
+		{2, 0, 0, 1},
+		{2, 1, 0, 2},
+		{2, 2, 2, 3},
+		{2, 5, 2, 3},
+		{0, 3, 2, 1},
+	} {
+		backend := &eventuallyConsistentResolver{BasicResolver: makeResolver().def, emptyAnswers: tc.emptyAnswers}
+		resolver, err := NewResolver(WithDefaultResolver(backend), WithRetryOnEmpty(tc.attempts, time.Millisecond))
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := resolver.Resolve(ctx, maddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != tc.addrs || backend.lookups.Load() != tc.lookups {
+			t.Fatalf("%d empty answers, %d attempts: expected %d addresses after %d lookups, got %d after %d",
+				tc.emptyAnswers, tc.attempts, tc.addrs, tc.lookups, len(addrs), backend.lookups.Load())
+		}
+	}
+
+	backend := &eventuallyConsistentResolver{BasicResolver: makeResolver().def, emptyAnswers: 1}
+	resolver, err := NewResolver(WithDefaultResolver(backend), WithRetryOnEmpty(1, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := resolver.Resolve(ctx, maddr); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the retry delay to be interrupted, got %v", err)
+	}
+
+	if _, err := NewResolver(WithRetryOnEmpty(-1, 0)); err == nil {
+		t.Fatal("expected negative attempts to be rejected")
+	}
+}
+
+func TestDomainResolverValidation(t *testing.T) {
+	for _, domain := range []string{"custom.test", "custom.test.", "_dnsaddr.example.com", "xn--bcher-kva.example"} {
+		if _, err := NewResolver(WithDomainResolver(domain, &MockResolver{})); err != nil {
+			t.Fatalf("%q: %s", domain, err)
+		}
+	}
+	for _, domain := range []string{
+		"",
+		".",
+		"not a domain/with slash",
+		"example..com",
+		".example.com",
+		strings.Repeat("a", 64) + ".com",
+		strings.Repeat("abcdefgh.", 32) + "com",
+	} {
+		if _, err := NewResolver(WithDomainResolver(domain, &MockResolver{})); err == nil {
+			t.Fatalf("expected %q to be rejected", domain)
+		}
+	}
+}
+
+func TestMaxDNSHops(t *testing.T) {
+	ctx := context.Background()
+	backend := &RecordingResolver{Resolver: makeResolver().def}
+	resolver, err := NewResolver(WithDefaultResolver(backend), WithMaxDNSHops(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	within := ma.StringCast("/dns4/example.com/tcp/1/dns6/example.com/tcp/2")
+	if _, err := resolver.ResolveAll(ctx, within); err != nil {
+		t.Fatal(err)
+	}
+
+	before := len(backend.Lookups())
+	tooMany := ma.StringCast("/dns4/example.com/tcp/1/dns6/example.com/tcp/2/dns/example.com/tcp/3")
+	if _, err := resolver.Resolve(ctx, tooMany); !errors.Is(err, ErrTooManyHops) {
+		t.Fatalf("expected ErrTooManyHops from Resolve, got %v", err)
+	}
+	if _, err := resolver.ResolveAll(ctx, tooMany); !errors.Is(err, ErrTooManyHops) {
+		t.Fatalf("expected ErrTooManyHops from ResolveAll, got %v", err)
+	}
+	comps := []ma.Component{}
+	ma.ForEach(tooMany, func(c ma.Component) bool {
+		comps = append(comps, c)
+		return true
+	})
+	if _, err := resolver.ResolveComponents(ctx, comps); !errors.Is(err, ErrTooManyHops) {
+		t.Fatalf("expected ErrTooManyHops from ResolveComponents, got %v", err)
+	}
+	if lookups := backend.Lookups()[before:]; len(lookups) != 0 {
+		t.Fatalf("expected no lookups, got %+v", lookups)
+	}
+
+	// The default limit is generous, but still applies.
+	long := strings.Repeat("/dns4/example.com/tcp/1", defaultMaxDNSHops+1)
+	if _, err := (&Resolver{def: backend}).Resolve(ctx, ma.StringCast(long)); !errors.Is(err, ErrTooManyHops) {
+		t.Fatalf("expected ErrTooManyHops with the default limit, got %v", err)
+	}
+
+	if _, err := NewResolver(WithMaxDNSHops(0)); err == nil {
+		t.Fatal("expected a zero limit to be rejected")
+	}
+}
+
+func TestResolveWith(t *testing.T) {
+	ctx := context.Background()
+	configured := &RecordingResolver{Resolver: makeResolver().def}
+	custom := &RecordingResolver{Resolver: makeResolver().def}
+	resolver, err := NewResolver(
+		WithDefaultResolver(configured),
+		WithDomainResolver("custom.test", custom),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	override := &RecordingResolver{Resolver: &MockResolver{
+		IP: map[string][]net.IPAddr{
+			"example.com":     {ip4b},
+			"www.custom.test": {ip6b},
+		},
+		TXT: map[string][]string{
+			"_dnsaddr.example.com": {txtb},
+		},
+	}}
+
+	for _, tc := range []struct {
+		maddr    string
+		expected ma.Multiaddr
+	}{
+		{"/dns4/example.com", ip4mb},
+		{"/dns6/www.custom.test", ip6mb},
+		{"/dnsaddr/example.com", ip6ma},
+	} {
+		addrs, err := resolver.ResolveWith(ctx, ma.StringCast(tc.maddr), override)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || !addrs[0].Equal(tc.expected) {
+			t.Fatalf("%s: expected [%s], got %v", tc.maddr, tc.expected, addrs)
+		}
+	}
+	if n := len(override.Lookups()); n != 3 {
+		t.Fatalf("expected 3 lookups with the override, got %d", n)
+	}
+	if len(configured.Lookups()) != 0 || len(custom.Lookups()) != 0 {
+		t.Fatalf("expected no lookups with the configured resolvers, got %+v and %+v",
+			configured.Lookups(), custom.Lookups())
+	}
+
+	// Resolve still uses the configured resolvers.
+	addrs, err := resolver.Resolve(ctx, ma.StringCast("/dns4/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 || !addrs[0].Equal(ip4ma) || len(configured.Lookups()) != 1 {
+		t.Fatalf("expected [%s %s] from the configured resolver, got %v", ip4ma, ip4mb, addrs)
+	}
+
+	if _, err := resolver.ResolveWith(ctx, ma.StringCast("/dns4/example.com"), nil); err == nil {
+		t.Fatal("expected an error without a backend")
+	}
+}
+
+func TestResolveWithNestedResolver(t *testing.T) {
+	ctx := context.Background()
+	outer, err := NewResolver(WithDefaultResolver(&failingResolver{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := NewResolver(WithDefaultResolver(&MockResolver{
+		IP:  map[string][]net.IPAddr{"example.com": {ip4b}},
+		TXT: map[string][]string{"_dnsaddr.example.com": {txtb}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The inner resolver looks names up with its own backends, not with itself.
+	for maddr, expected := range map[string]ma.Multiaddr{
+		"/dns4/example.com":    ip4mb,
+		"/dnsaddr/example.com": ip6ma,
+	} {
+		addrs, err := outer.ResolveWith(ctx, ma.StringCast(maddr), inner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || !addrs[0].Equal(expected) {
+			t.Fatalf("%s: expected [%s], got %v", maddr, expected, addrs)
+		}
+	}
+}
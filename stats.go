@@ -0,0 +1,79 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+)
+
+// ResolverStats is a snapshot of the cumulative counters of a Resolver.
+type ResolverStats struct {
+	// IPLookups and TXTLookups count the queries sent to basic resolvers.
+	IPLookups  uint64
+	TXTLookups uint64
+	// NotFound counts the queries that failed because the name doesn't exist.
+	NotFound uint64
+	// Errors counts the queries that failed for any other reason.
+	Errors uint64
+	// StaticHits counts the components resolved from static overrides.
+	StaticHits uint64
+}
+
+type stats struct {
+	ipLookups  atomic.Uint64
+	txtLookups atomic.Uint64
+	notFound   atomic.Uint64
+	errors     atomic.Uint64
+	staticHits atomic.Uint64
+}
+
+// Stats returns a snapshot of the counters the resolver has accumulated since its creation.
+func (r *Resolver) Stats() ResolverStats {
+	return ResolverStats{
+		IPLookups:  r.stats.ipLookups.Load(),
+		TXTLookups: r.stats.txtLookups.Load(),
+		NotFound:   r.stats.notFound.Load(),
+		Errors:     r.stats.errors.Load(),
+		StaticHits: r.stats.staticHits.Load(),
+	}
+}
+
+func (r *Resolver) queryIPAddr(ctx context.Context, rslv BasicResolver, domain string) ([]net.IPAddr, error) {
+	lookup := func() ([]net.IPAddr, error) {
+		r.stats.ipLookups.Add(1)
+		res, err := rslv.LookupIPAddr(ctx, domain)
+		err = r.asNotFound(domain, err)
+		r.countError(err)
+		return res, err
+	}
+	if memo, ok := ctx.Value(lookupMemoKey{}).(*lookupMemo); ok {
+		return memo.lookupIPAddr(rslv, domain, lookup)
+	}
+	return lookup()
+}
+
+func (r *Resolver) queryTXT(ctx context.Context, rslv BasicResolver, name string) ([]string, error) {
+	r.stats.txtLookups.Add(1)
+	res, err := rslv.LookupTXT(ctx, name)
+	err = r.asNotFound(name, err)
+	r.countError(err)
+	return res, err
+}
+
+func (r *Resolver) countError(err error) {
+	if err == nil {
+		return
+	}
+	if isNotFound(err) {
+		r.stats.notFound.Add(1)
+	} else {
+		r.stats.errors.Add(1)
+	}
+}
+
+// reports whether err is a *net.DNSError for a name that doesn't exist.
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
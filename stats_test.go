@@ -0,0 +1,111 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestStats(t *testing.T) {
+	mock := makeResolver().def
+	custom := &failingResolver{}
+	notFound := &ZoneResolver{}
+	resolver, err := NewResolver(
+		WithDefaultResolver(mock),
+		WithDomainResolver("failing.test", custom),
+		WithDomainResolver("missing.test", notFound),
+		WithStaticOverrides(map[string][]ma.Multiaddr{"pinned.com": {ip4ma}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, s := range []string{
+		"/dns4/example.com",
+		"/dns6/example.com",
+		"/dnsaddr/example.com",
+		"/dnsaddr/pinned.com",
+		"/dns/pinned.com",
+		"/ip4/1.2.3.4",
+		"/dns4/1.2.3.4",
+	} {
+		if _, err := resolver.Resolve(ctx, ma.StringCast(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range []string{"/dns/failing.test", "/dnsaddr/missing.test", "/dns/missing.test"} {
+		if _, err := resolver.Resolve(ctx, ma.StringCast(s)); err == nil {
+			t.Fatalf("expected %s to fail", s)
+		}
+	}
+	if _, err := resolver.LookupTXT(ctx, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ResolverStats{
+		IPLookups:  4,
+		TXTLookups: 3,
+		NotFound:   2,
+		Errors:     1,
+		StaticHits: 2,
+	}
+	if stats := resolver.Stats(); stats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestTreatErrorsAsNXDOMAIN(t *testing.T) {
+	servfail := &net.DNSError{Err: "server misbehaving", Name: "broken.test", IsTemporary: true}
+	backend := &errorResolver{err: servfail}
+	match := func(err error) bool {
+		var dnsErr *net.DNSError
+		return errors.As(err, &dnsErr) && dnsErr.Err == "server misbehaving"
+	}
+	ctx := context.Background()
+
+	plain, err := NewResolver(WithDefaultResolver(backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := plain.Resolve(ctx, ma.StringCast("/dns/broken.test")); err != servfail {
+		t.Fatalf("expected the backend error by default, got %v", err)
+	}
+
+	resolver, err := NewResolver(WithDefaultResolver(backend), WithTreatErrorsAsNXDOMAIN(match))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"/dns/broken.test", "/dnsaddr/broken.test"} {
+		_, err := resolver.Resolve(ctx, ma.StringCast(s))
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound || dnsErr.IsTemporary {
+			t.Fatalf("%s: expected a not found error, got %#v", s, err)
+		}
+	}
+	if stats := resolver.Stats(); stats.NotFound != 2 || stats.Errors != 0 {
+		t.Fatalf("expected 2 not found lookups and no errors, got %+v", stats)
+	}
+
+	// Errors that don't match are left alone.
+	backend.err = errors.New("connection refused")
+	if _, err := resolver.Resolve(ctx, ma.StringCast("/dns/broken.test")); err != backend.err {
+		t.Fatalf("expected the backend error, got %v", err)
+	}
+}
+
+// errorResolver fails every lookup with err.
+type errorResolver struct {
+	err error
+}
+
+func (r *errorResolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return nil, r.err
+}
+
+func (r *errorResolver) LookupTXT(context.Context, string) ([]string, error) {
+	return nil, r.err
+}
@@ -2,16 +2,19 @@ package madns
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	ma "github.com/multiformats/go-multiaddr"
 )
 
 func Matches(maddr ma.Multiaddr) (matches bool) {
 	ma.ForEach(maddr, func(c ma.Component) bool {
-		switch c.Protocol().Code {
-		case dnsProtocol.Code, dns4Protocol.Code, dns6Protocol.Code, dnsaddrProtocol.Code:
-			matches = true
-		}
+		matches = isResolvable(c.Protocol().Code)
 		return !matches
 	})
 	return matches
@@ -31,6 +34,30 @@ func addrLen(maddr ma.Multiaddr) int {
 	return length
 }
 
+// counts the resolvable components in the multiaddr
+func countResolvable(maddr ma.Multiaddr) int {
+	n := 0
+	ma.ForEach(maddr, func(c ma.Component) bool {
+		if isResolvable(c.Protocol().Code) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// joins the components into a multiaddr, returning nil if there are none.
+func joinComponents(comps []ma.Component) ma.Multiaddr {
+	if len(comps) == 0 {
+		return nil
+	}
+	ms := make([]ma.Multiaddr, len(comps))
+	for i := range comps {
+		ms[i] = &comps[i]
+	}
+	return ma.Join(ms...)
+}
+
 // trims `offset` components from the beginning of the multiaddr.
 func offset(maddr ma.Multiaddr, offset int) ma.Multiaddr {
 	_, after := ma.SplitFunc(maddr, func(c ma.Component) bool {
@@ -42,3 +69,162 @@ func offset(maddr ma.Multiaddr, offset int) ma.Multiaddr {
 	})
 	return after
 }
+
+// StripPeerID removes a trailing /p2p component from the multiaddr, if there is one. Any /p2p
+// components earlier in the multiaddr, such as that of a circuit relay, are left in place.
+func StripPeerID(maddr ma.Multiaddr) ma.Multiaddr {
+	rest, _ := splitPeerID(maddr)
+	return rest
+}
+
+// reports whether the multiaddr has a component of any of the protocols.
+func hasProtocol(maddr ma.Multiaddr, codes []int) (found bool) {
+	ma.ForEach(maddr, func(c ma.Component) bool {
+		found = slices.Contains(codes, c.Protocol().Code)
+		return !found
+	})
+	return found
+}
+
+// inserts port after the leading address of a multiaddr that has no /tcp or /udp component.
+func withDefaultPort(maddr ma.Multiaddr, port *ma.Component) ma.Multiaddr {
+	first, rest := ma.SplitFirst(maddr)
+	if first == nil || hasProtocol(maddr, []int{ma.P_TCP, ma.P_UDP}) {
+		return maddr
+	}
+	switch first.Protocol().Code {
+	case ma.P_IP4, ma.P_IP6, ma.P_DNS, ma.P_DNS4, ma.P_DNS6:
+	default:
+		return maddr
+	}
+	if rest == nil {
+		return first.Encapsulate(port)
+	}
+	return ma.Join(first, port, rest)
+}
+
+// splits off the trailing /p2p component of the multiaddr, if any.
+func splitPeerID(maddr ma.Multiaddr) (ma.Multiaddr, *ma.Component) {
+	rest, last := ma.SplitLast(maddr)
+	if last == nil || last.Protocol().Code != ma.P_P2P {
+		return maddr, nil
+	}
+	return rest, last
+}
+
+// replaces IPv4-mapped /ip6 components with the equivalent /ip4 component.
+func unmapIPv4(maddr ma.Multiaddr) ma.Multiaddr {
+	var (
+		parts    []ma.Multiaddr
+		unmapped bool
+	)
+	ma.ForEach(maddr, func(c ma.Component) bool {
+		if c.Protocol().Code == ma.P_IP6 {
+			if ip4 := net.IP(c.RawValue()).To4(); ip4 != nil {
+				parts = append(parts, ma.StringCast("/ip4/"+ip4.String()))
+				unmapped = true
+				return true
+			}
+		}
+		parts = append(parts, &c)
+		return true
+	})
+	if !unmapped {
+		return maddr
+	}
+	return ma.Join(parts...)
+}
+
+// lowercases the domains of any dns components in the multiaddr.
+func lowercaseDomains(maddr ma.Multiaddr) ma.Multiaddr {
+	var (
+		parts   []ma.Multiaddr
+		changed bool
+	)
+	ma.ForEach(maddr, func(c ma.Component) bool {
+		if isDNSProtocol(c.Protocol().Code) {
+			if lower := strings.ToLower(c.Value()); lower != c.Value() {
+				if lc, err := ma.NewComponent(c.Protocol().Name, lower); err == nil {
+					parts = append(parts, lc)
+					changed = true
+					return true
+				}
+			}
+		}
+		parts = append(parts, &c)
+		return true
+	})
+	if !changed {
+		return maddr
+	}
+	return ma.Join(parts...)
+}
+
+// splits a domain with a trailing :port, as in example.com:4001, into its domain and port.
+func splitPortSuffix(value string) (string, string, bool) {
+	i := strings.LastIndexByte(value, ':')
+	if i <= 0 || strings.IndexByte(value[:i], ':') >= 0 {
+		// no port, or an IPv6 literal.
+		return "", "", false
+	}
+	host, port := value[:i], value[i+1:]
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || n == 0 {
+		return "", "", false
+	}
+	return host, port, true
+}
+
+// forEachLimit calls fn for every index in [0, n) with at most limit calls in flight, returning the first
+// error encountered. The context passed to fn is canceled as soon as a call fails.
+func forEachLimit(ctx context.Context, n, limit int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, limit)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// checks that domain is a well-formed DNS name, with or without a trailing dot. Labels may
+// contain letters, digits, hyphens and underscores.
+func checkDomain(domain string) error {
+	name := strings.TrimSuffix(domain, ".")
+	if name == "" {
+		return fmt.Errorf("invalid domain %q: empty name", domain)
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("invalid domain %q: longer than 253 characters", domain)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("invalid domain %q: labels must be 1 to 63 characters long", domain)
+		}
+		for _, c := range label {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("invalid domain %q: invalid character %q", domain, c)
+			}
+		}
+	}
+	return nil
+}
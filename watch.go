@@ -0,0 +1,51 @@
+package madns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Watch resolves maddr now and then every interval in the background, calling onChange with the
+// resolved addresses whenever they differ from the last ones, as compared by ResultFingerprint.
+// onChange is first called once maddr first resolves. Failed resolutions are ignored, keeping the
+// last addresses. onChange is never called concurrently with itself.
+//
+// Watching stops when ctx is done or stop is called. Once stop returns, onChange won't be called
+// again, so stop must not be called from onChange. Watch panics if interval isn't positive.
+func (r *Resolver) Watch(ctx context.Context, maddr ma.Multiaddr, interval time.Duration, onChange func([]ma.Multiaddr)) (stop func()) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("madns: non-positive watch interval %s", interval))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last string
+		for {
+			addrs, err := r.Resolve(ctx, maddr)
+			if err == nil && ctx.Err() == nil {
+				if fp := ResultFingerprint(addrs); fp != last {
+					last = fp
+					onChange(addrs)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,138 @@
+package madns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// changingResolver answers IP lookups with addresses that can be changed during a test.
+type changingResolver struct {
+	mu      sync.Mutex
+	addrs   []net.IPAddr
+	lookups atomic.Int64
+}
+
+func (r *changingResolver) set(addrs ...net.IPAddr) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addrs = addrs
+}
+
+func (r *changingResolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	r.lookups.Add(1)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.addrs, nil
+}
+
+func (r *changingResolver) LookupTXT(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+func TestWatch(t *testing.T) {
+	backend := &changingResolver{}
+	backend.set(ip4a, ip6a)
+	resolver, err := NewResolver(WithDefaultResolver(backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan []ma.Multiaddr, 10)
+	stop := resolver.Watch(context.Background(), ma.StringCast("/dns/example.com"), time.Millisecond, func(addrs []ma.Multiaddr) {
+		changes <- addrs
+	})
+	defer stop()
+
+	expectChange := func(expected ...ma.Multiaddr) {
+		t.Helper()
+		select {
+		case addrs := <-changes:
+			if ResultFingerprint(addrs) != ResultFingerprint(expected) {
+				t.Fatalf("expected %v, got %v", expected, addrs)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected a change to %v", expected)
+		}
+	}
+	waitForLookups := func(n int64) {
+		t.Helper()
+		target := backend.lookups.Load() + n
+		for backend.lookups.Load() < target {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	expectChange(ip4ma, ip6ma)
+
+	// The same addresses in another order aren't a change.
+	backend.set(ip6a, ip4a)
+	waitForLookups(3)
+	select {
+	case addrs := <-changes:
+		t.Fatalf("expected no change, got %v", addrs)
+	default:
+	}
+
+	backend.set(ip6a, ip4b)
+	expectChange(ip6ma, ip4mb)
+
+	stop()
+	backend.set(ip6b)
+	lookups := backend.lookups.Load()
+	time.Sleep(10 * time.Millisecond)
+	if n := backend.lookups.Load(); n != lookups {
+		t.Fatalf("expected no lookups after stopping, got %d", n-lookups)
+	}
+	select {
+	case addrs := <-changes:
+		t.Fatalf("expected no change after stopping, got %v", addrs)
+	default:
+	}
+}
+
+func TestWatchContextCancel(t *testing.T) {
+	backend := &changingResolver{}
+	backend.set(ip4a)
+	resolver, err := NewResolver(WithDefaultResolver(backend))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan []ma.Multiaddr, 10)
+	stop := resolver.Watch(ctx, ma.StringCast("/dns4/example.com"), time.Millisecond, func(addrs []ma.Multiaddr) {
+		changes <- addrs
+	})
+	<-changes
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watch to stop once its context is canceled")
+	}
+}
+
+func TestWatchInvalidInterval(t *testing.T) {
+	resolver, err := NewResolver(WithDefaultResolver(&changingResolver{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a zero interval to panic")
+		}
+	}()
+	resolver.Watch(context.Background(), ma.StringCast("/dns4/example.com"), 0, func([]ma.Multiaddr) {})
+}
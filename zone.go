@@ -0,0 +1,107 @@
+package madns
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneResolver is a BasicResolver that answers A, AAAA and TXT lookups from a DNS zone loaded
+// in memory, without touching the network. Names missing from the zone fail like they would
+// with net.Resolver, and CNAME records are followed like net.Resolver does, including for
+// the _dnsaddr TXT records of /dnsaddr components.
+type ZoneResolver struct {
+	ip    map[string][]net.IPAddr
+	txt   map[string][]string
+	cname map[string]string
+}
+
+// maxCNAMEChain bounds the number of CNAME records followed by a lookup.
+const maxCNAMEChain = 8
+
+var _ BasicResolver = (*ZoneResolver)(nil)
+
+// NewZoneResolver parses a zone in the master file format of RFC 1035, as used by BIND, from r.
+// origin is the initial origin of the zone, and file is the name used in error messages.
+func NewZoneResolver(r io.Reader, origin, file string) (*ZoneResolver, error) {
+	zr := &ZoneResolver{
+		ip:    make(map[string][]net.IPAddr),
+		txt:   make(map[string][]string),
+		cname: make(map[string]string),
+	}
+
+	zp := dns.NewZoneParser(r, origin, file)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		name := zoneKey(rr.Header().Name)
+		switch rr := rr.(type) {
+		case *dns.A:
+			zr.ip[name] = append(zr.ip[name], net.IPAddr{IP: rr.A})
+		case *dns.AAAA:
+			zr.ip[name] = append(zr.ip[name], net.IPAddr{IP: rr.AAAA})
+		case *dns.TXT:
+			// like net.Resolver, join the strings of a record together.
+			zr.txt[name] = append(zr.txt[name], strings.Join(rr.Txt, ""))
+		case *dns.CNAME:
+			zr.cname[name] = zoneKey(rr.Target)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	return zr, nil
+}
+
+// NewResolverFromZoneFile creates a Resolver that resolves every name from the zone file at
+// path, for offline use. Options are applied on top of the zone file resolver, which is set as
+// the default resolver.
+func NewResolverFromZoneFile(path string, opts ...Option) (*Resolver, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := NewZoneResolver(f, "", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewResolver(append([]Option{WithDefaultResolver(zr)}, opts...)...)
+}
+
+func (r *ZoneResolver) LookupIPAddr(ctx context.Context, name string) ([]net.IPAddr, error) {
+	return zoneLookup(r, r.ip, name)
+}
+
+func (r *ZoneResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return zoneLookup(r, r.txt, name)
+}
+
+// zoneLookup looks up name in records, following CNAME records.
+func zoneLookup[T any](r *ZoneResolver, records map[string]T, name string) (T, error) {
+	key := zoneKey(name)
+	for i := 0; i <= maxCNAMEChain; i++ {
+		target, ok := r.cname[key]
+		if !ok {
+			results, ok := records[key]
+			if !ok {
+				return results, notFound(name)
+			}
+			return results, nil
+		}
+		key = target
+	}
+	var zero T
+	return zero, &net.DNSError{Err: "too many CNAME records", Name: name}
+}
+
+func zoneKey(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
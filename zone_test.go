@@ -0,0 +1,135 @@
+package madns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const testZone = `$ORIGIN example.com.
+$TTL 3600
+@           IN SOA  ns.example.com. admin.example.com. 1 7200 3600 1209600 3600
+@           IN A    192.0.2.1
+@           IN A    192.0.2.2
+@           IN AAAA 2001:db8::a3
+node        IN AAAA 2001:db8::a4
+_dnsaddr    IN TXT  "dnsaddr=/ip4/192.0.2.1/tcp/123"
+_dnsaddr    IN TXT  "dnsaddr=/dns6/node.example.com" "/tcp/123"
+_dnsaddr    IN TXT  "v=something-else"
+`
+
+func TestZoneResolver(t *testing.T) {
+	zr, err := NewZoneResolver(strings.NewReader(testZone), "", "test.zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	ips, err := zr.LookupIPAddr(ctx, "Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 3 || !ips[0].IP.Equal(ip4a.IP) || !ips[2].IP.Equal(ip6a.IP) {
+		t.Fatalf("expected [%s %s %s], got %+v", ip4a, ip4b, ip6a, ips)
+	}
+
+	txts, err := zr.LookupTXT(ctx, "_dnsaddr.example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txts) != 3 || txts[1] != "dnsaddr=/dns6/node.example.com/tcp/123" {
+		t.Fatalf("expected the strings of a record to be joined, got %+v", txts)
+	}
+
+	_, err = zr.LookupIPAddr(ctx, "missing.example.com")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+
+	if _, err := NewZoneResolver(strings.NewReader("@ IN A not-an-ip\n"), "example.com.", "bad.zone"); err == nil {
+		t.Fatal("expected a malformed zone to fail to parse")
+	}
+}
+
+func TestResolverFromZoneFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.com.zone")
+	if err := os.WriteFile(path, []byte(testZone), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := NewResolverFromZoneFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, err := resolver.ResolveAll(context.Background(), ma.StringCast("/dnsaddr/example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ma.Multiaddr{txtmd, ma.Join(ip6mb, ma.StringCast("/tcp/123"))}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, addrs)
+	}
+	for i := range expected {
+		if !expected[i].Equal(addrs[i]) {
+			t.Fatalf("%d: expected %s, got %s", i, expected[i], addrs[i])
+		}
+	}
+
+	if _, err := NewResolverFromZoneFile(filepath.Join(t.TempDir(), "missing.zone")); err == nil {
+		t.Fatal("expected a missing zone file to fail")
+	}
+}
+
+const testCNAMEZone = `$TTL 3600
+_dnsaddr.host.example.       IN CNAME records.provider.example.
+records.provider.example.    IN TXT   "dnsaddr=/ip4/192.0.2.1/tcp/123"
+records.provider.example.    IN TXT   "dnsaddr=/dns4/www.host.example/tcp/123"
+www.host.example.            IN CNAME edge.provider.example.
+edge.provider.example.       IN A     192.0.2.2
+dangling.host.example.       IN CNAME missing.provider.example.
+loop1.host.example.          IN CNAME loop2.host.example.
+loop2.host.example.          IN CNAME loop1.host.example.
+`
+
+func TestZoneResolverCNAME(t *testing.T) {
+	zr, err := NewZoneResolver(strings.NewReader(testCNAMEZone), "", "cname.zone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := NewResolver(WithDefaultResolver(zr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	addrs, err := resolver.ResolveAll(ctx, ma.StringCast("/dnsaddr/host.example"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ma.Multiaddr{txtmd, ma.Join(ip4mb, ma.StringCast("/tcp/123"))}
+	if len(addrs) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, addrs)
+	}
+	for i := range expected {
+		if !expected[i].Equal(addrs[i]) {
+			t.Fatalf("%d: expected %s, got %s", i, expected[i], addrs[i])
+		}
+	}
+
+	_, err = zr.LookupIPAddr(ctx, "dangling.host.example")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Fatalf("expected a dangling CNAME not to be found, got %v", err)
+	}
+	_, err = zr.LookupTXT(ctx, "loop1.host.example")
+	if !errors.As(err, &dnsErr) || dnsErr.IsNotFound {
+		t.Fatalf("expected a CNAME loop to fail, got %v", err)
+	}
+}